@@ -0,0 +1,266 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Option type for durations like 90s, 15m, 1h30m or 2d. Discord has no such type, so these options are registered
+// as strings on slash commands and parsed by the bot, which makes them work the same way on prefix commands.
+const optionDuration discordgo.ApplicationCommandOptionType = 100
+
+var (
+	userMention    = regexp.MustCompile(`^<@!?(\d+)>$`) // Mention of a user, with the optional nickname marker.
+	channelMention = regexp.MustCompile(`^<#(\d+)>$`)   // Mention of a channel.
+	roleMention    = regexp.MustCompile(`^<@&(\d+)>$`)  // Mention of a role.
+	snowflake      = regexp.MustCompile(`^\d+$`)        // Raw Discord ID.
+)
+
+// The splitArgs function splits a string into arguments the way a shell does.
+// Arguments are separated by any amount of whitespace, quotes (double or single) group words into a single
+// argument and a backslash escapes the next character, so that quotes and spaces can be used inside arguments.
+// Single quotes only group words at the start of an argument, so that apostrophes like in "what's" are just text.
+func splitArgs(s string) (args []string, err error) {
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || (r == '\'' && !inArg):
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("missing closing %c quote", quote)
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return
+}
+
+// The bind method parses the arguments of a command according to the options the command declares.
+// An argument of the form name=value sets the option with that name, any other argument sets the next option
+// not set yet, in the order they are declared. When there are more arguments than options and the last option is
+// free text, it takes all the remaining arguments, so that "!ask is it raining" works without quotes.
+// The typed values are stored on the Options of the command and the arguments are replaced by the text of each
+// option, in the order they are declared, so handlers get the same arguments from prefix and slash commands.
+// Commands that don't declare any options get their arguments untouched.
+func (spec *CommandSpec) bind(c *Command) error {
+	if len(spec.Options) == 0 {
+		return nil
+	}
+	raw := make(map[string]string)
+	var positional []string
+	for _, arg := range c.Args {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			if option := spec.option(name); option != nil {
+				raw[option.Name] = value
+				continue
+			}
+		}
+		positional = append(positional, arg)
+	}
+	for i, option := range spec.Options {
+		if len(positional) == 0 {
+			break
+		}
+		if _, ok := raw[option.Name]; ok {
+			continue
+		}
+		raw[option.Name] = positional[0]
+		positional = positional[1:]
+		// The last option takes the remaining arguments if it is free text.
+		if i == len(spec.Options)-1 && option.Type == discordgo.ApplicationCommandOptionString && option.Choices == nil {
+			raw[option.Name] = strings.Join(append([]string{raw[option.Name]}, positional...), " ")
+			positional = nil
+		}
+	}
+	if len(positional) > 0 {
+		return errors.New("too many arguments")
+	}
+	c.Args = nil
+	c.Options = make(map[string]interface{})
+	for _, option := range spec.Options {
+		text, ok := raw[option.Name]
+		if !ok {
+			if option.Required {
+				return fmt.Errorf("missing %s", option.Name)
+			}
+			continue
+		}
+		value, err := parseOption(option, text)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", option.Name, err)
+		}
+		c.Options[option.Name] = value
+		c.Args = append(c.Args, text)
+	}
+	return nil
+}
+
+// The option method returns the option of a command with the given name, or nil if there is none.
+func (spec *CommandSpec) option(name string) *discordgo.ApplicationCommandOption {
+	for _, option := range spec.Options {
+		if strings.EqualFold(option.Name, name) {
+			return option
+		}
+	}
+	return nil
+}
+
+// The parseOption function converts the text of an option to a value of its type.
+// Integers become int64, numbers float64, booleans bool, durations time.Duration and users, channels and roles
+// the ID they mention. Anything else stays a string, which must be one of the choices of the option if it has any.
+func parseOption(option *discordgo.ApplicationCommandOption, text string) (interface{}, error) {
+	switch option.Type {
+	case discordgo.ApplicationCommandOptionInteger:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, errors.New("expected a whole number")
+		}
+		return n, checkRange(option, float64(n))
+	case discordgo.ApplicationCommandOptionNumber:
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, errors.New("expected a number")
+		}
+		return n, checkRange(option, n)
+	case discordgo.ApplicationCommandOptionBoolean:
+		switch strings.ToLower(text) {
+		case "true", "yes", "on", "1":
+			return true, nil
+		case "false", "no", "off", "0":
+			return false, nil
+		}
+		return nil, errors.New("expected yes or no")
+	case discordgo.ApplicationCommandOptionUser:
+		return mentionID(text, "a user", userMention)
+	case discordgo.ApplicationCommandOptionChannel:
+		return mentionID(text, "a channel", channelMention)
+	case discordgo.ApplicationCommandOptionRole:
+		return mentionID(text, "a role", roleMention)
+	case discordgo.ApplicationCommandOptionMentionable:
+		return mentionID(text, "a user or role", userMention, roleMention)
+	case optionDuration:
+		d, err := parseDuration(text)
+		if err != nil {
+			return nil, errors.New("expected a duration like 90s, 15m, 1h30m or 2d")
+		}
+		return d, nil
+	}
+	if option.Choices != nil {
+		var names []string
+		for _, choice := range option.Choices {
+			if strings.EqualFold(fmt.Sprint(choice.Value), text) {
+				return fmt.Sprint(choice.Value), nil
+			}
+			names = append(names, choice.Name)
+		}
+		return nil, errors.New("expected one of " + strings.Join(names, ", "))
+	}
+	return text, nil
+}
+
+// Small utility function that checks that a numeric option is within its minimum and maximum values, if set.
+func checkRange(option *discordgo.ApplicationCommandOption, n float64) error {
+	if option.MinValue != nil && n < *option.MinValue {
+		return fmt.Errorf("must be at least %v", *option.MinValue)
+	}
+	if option.MaxValue != 0 && n > option.MaxValue {
+		return fmt.Errorf("must be at most %v", option.MaxValue)
+	}
+	return nil
+}
+
+// Small utility function that returns the ID of a mention matching one of the patterns, or the text itself if it
+// is already a raw ID. The what argument describes what was expected, for the error message.
+func mentionID(text string, what string, patterns ...*regexp.Regexp) (string, error) {
+	if snowflake.MatchString(text) {
+		return text, nil
+	}
+	for _, pattern := range patterns {
+		if match := pattern.FindStringSubmatch(text); match != nil {
+			return match[1], nil
+		}
+	}
+	return "", errors.New("expected " + what)
+}
+
+// The parseDuration function parses a duration like time.ParseDuration does, but also accepts days (2d, 1d12h).
+func parseDuration(text string) (time.Duration, error) {
+	var days time.Duration
+	if before, after, ok := strings.Cut(text, "d"); ok {
+		n, err := strconv.Atoi(before)
+		if err != nil {
+			return 0, err
+		}
+		if n < 0 {
+			return 0, errors.New("negative duration")
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		text = after
+		if text == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("negative duration")
+	}
+	return days + d, nil
+}
@@ -0,0 +1,199 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"ask is it raining", []string{"ask", "is", "it", "raining"}, false},
+		{"  spaced \t out  ", []string{"spaced", "out"}, false},
+		{`quote add "two words"`, []string{"quote", "add", "two words"}, false},
+		{`quote add 'two words'`, []string{"quote", "add", "two words"}, false},
+		{"ask what's the gap", []string{"ask", "what's", "the", "gap"}, false},
+		{"quote add I can't", []string{"quote", "add", "I", "can't"}, false},
+		{"it's", []string{"it's"}, false},
+		{`name="two words"`, []string{"name=two words"}, false},
+		{`""`, []string{""}, false},
+		{`say "it's fine"`, []string{"say", "it's fine"}, false},
+		{`say 'a "b" c'`, []string{"say", `a "b" c`}, false},
+		{`a\ b`, []string{"a b"}, false},
+		{`\"quoted\"`, []string{`"quoted"`}, false},
+		{`"a \" b"`, []string{`a " b`}, false},
+		{`'a \ b'`, []string{`a \ b`}, false},
+		{`trailing\`, []string{`trailing\`}, false},
+		{`"unclosed`, nil, true},
+		{`'unclosed`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("splitArgs(%q) error = %v, want error %v", test.in, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{"90s", 90 * time.Second, false},
+		{"15m", 15 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"2d", 48 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"1d30m", 24*time.Hour + 30*time.Minute, false},
+		{"0s", 0, false},
+		{"", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"1h2d", 0, true},
+		{"2dd", 0, true},
+		{"-1d", 0, true},
+		{"-5m", 0, true},
+		{"1d-5m", 0, true},
+		{"soon", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseDuration(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("parseDuration(%q) error = %v, want error %v", test.in, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseOption(t *testing.T) {
+	min := 1.0
+	tests := []struct {
+		option *discordgo.ApplicationCommandOption
+		in     string
+		want   interface{}
+		err    bool
+	}{
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionInteger}, "42", int64(42), false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionInteger}, "4.2", nil, true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionInteger, MinValue: &min, MaxValue: 10}, "0", int64(0), true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionInteger, MinValue: &min, MaxValue: 10}, "11", int64(11), true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionInteger, MinValue: &min, MaxValue: 10}, "10", int64(10), false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionNumber}, "2.5", 2.5, false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionNumber}, "two", nil, true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionBoolean}, "Yes", true, false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionBoolean}, "off", false, false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionBoolean}, "maybe", nil, true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionUser}, "<@123>", "123", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionUser}, "<@!123>", "123", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionUser}, "123", "123", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionUser}, "<@&123>", "", true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionChannel}, "<#456>", "456", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionRole}, "<@&789>", "789", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionMentionable}, "<@&789>", "789", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionMentionable}, "@everyone", "", true},
+		{&discordgo.ApplicationCommandOption{Type: optionDuration}, "1d12h", 36 * time.Hour, false},
+		{&discordgo.ApplicationCommandOption{Type: optionDuration}, "later", nil, true},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString}, "free text", "free text", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString, Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "Add", Value: "add"}, {Name: "Remove", Value: "remove"}}}, "ADD", "add", false},
+		{&discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString, Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "Add", Value: "add"}, {Name: "Remove", Value: "remove"}}}, "edit", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseOption(test.option, test.in)
+		if (err != nil) != test.err {
+			t.Errorf("parseOption(%v, %q) error = %v, want error %v", test.option.Type, test.in, err, test.err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseOption(%v, %q) = %#v, want %#v", test.option.Type, test.in, got, test.want)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	spec := &CommandSpec{
+		Name: "test",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Name: "count", Type: discordgo.ApplicationCommandOptionInteger, Required: true},
+			{Name: "unit", Type: discordgo.ApplicationCommandOptionString, Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "c", Value: "c"}, {Name: "f", Value: "f"}}},
+			{Name: "text", Type: discordgo.ApplicationCommandOptionString},
+		},
+	}
+	tests := []struct {
+		args    []string
+		options map[string]interface{}
+		rest    []string
+		err     bool
+	}{
+		{[]string{"3"}, map[string]interface{}{"count": int64(3)}, []string{"3"}, false},
+		{[]string{"3", "c", "is", "it", "cold"}, map[string]interface{}{"count": int64(3), "unit": "c", "text": "is it cold"},
+			[]string{"3", "c", "is it cold"}, false},
+		{[]string{"text=hello there", "count=2"}, map[string]interface{}{"count": int64(2), "text": "hello there"},
+			[]string{"2", "hello there"}, false},
+		{[]string{"unit=F", "5", "hi"}, map[string]interface{}{"count": int64(5), "unit": "f", "text": "hi"},
+			[]string{"5", "F", "hi"}, false},
+		{[]string{"5", "x=1"}, map[string]interface{}{"count": int64(5), "unit": "x=1"}, nil, true},
+		{[]string{}, nil, nil, true},
+		{[]string{"unit=c"}, nil, nil, true},
+		{[]string{"three"}, nil, nil, true},
+	}
+	for _, test := range tests {
+		c := Command{Name: "test", Args: test.args}
+		err := spec.bind(&c)
+		if (err != nil) != test.err {
+			t.Errorf("bind(%q) error = %v, want error %v", test.args, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if !reflect.DeepEqual(c.Options, test.options) {
+			t.Errorf("bind(%q) options = %v, want %v", test.args, c.Options, test.options)
+		}
+		if !reflect.DeepEqual(c.Args, test.rest) {
+			t.Errorf("bind(%q) args = %q, want %q", test.args, c.Args, test.rest)
+		}
+	}
+	// Commands without options get their arguments untouched.
+	c := Command{Name: "plain", Args: []string{"a", "b=c"}}
+	if err := (&CommandSpec{Name: "plain"}).bind(&c); err != nil || !reflect.DeepEqual(c.Args, []string{"a", "b=c"}) || c.Options != nil {
+		t.Errorf("bind without options = %q, %v, %v", c.Args, c.Options, err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Function that suggests values for an option of a slash command while the user is typing it.
+// It receives the command with the options typed so far and the value of the option being typed.
+type completer func(c Command, value string) ([]*discordgo.ApplicationCommandOptionChoice, error)
+
+// Maximum number of suggestions Discord shows for an option.
+const maxSuggestions = 25
+
+var (
+	zones     []string    // Names of the time zones, loaded once (see timezones).
+	zonesOnce sync.Once   // Loads zones.
+	zoneAreas = []string{ // Areas of the canonical time zones, the first part of their names.
+		"Africa", "America", "Antarctica", "Arctic", "Asia", "Atlantic", "Australia", "Europe", "Indian", "Pacific",
+	}
+)
+
+// The autocomplete function answers an autocomplete interaction with the suggestions for the option being typed.
+func autocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	spec, ok := lookupCommand(data.Name)
+	if ok {
+		for _, option := range data.Options {
+			complete := spec.Complete[option.Name]
+			if !option.Focused || complete == nil {
+				continue
+			}
+			all, err := complete(interactionCommand(spec, i), fmt.Sprint(option.Value))
+			if err != nil {
+				log.Println("autocomplete:", err)
+			}
+			choices = suggest(fmt.Sprint(option.Value), all)
+		}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Println("autocomplete:", err)
+	}
+}
+
+// The suggest function picks the choices matching what the user typed, ignoring case and duplicates.
+// Choices starting with the value come first, followed by the ones containing it, up to what Discord can show.
+func suggest(value string, choices []*discordgo.ApplicationCommandOptionChoice) []*discordgo.ApplicationCommandOptionChoice {
+	value = strings.ToLower(strings.TrimSpace(value))
+	var prefixed, contained []*discordgo.ApplicationCommandOptionChoice
+	seen := make(map[string]bool)
+	for _, choice := range choices {
+		key := strings.ToLower(fmt.Sprint(choice.Value))
+		name := strings.ToLower(choice.Name)
+		if seen[key] || key == "" {
+			continue
+		}
+		seen[key] = true
+		choice.Name = truncate(choice.Name, 100)
+		switch {
+		case strings.HasPrefix(key, value) || strings.HasPrefix(name, value):
+			prefixed = append(prefixed, choice)
+		case strings.Contains(key, value) || strings.Contains(name, value):
+			contained = append(contained, choice)
+		}
+	}
+	suggestions := append(prefixed, contained...)
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// Small utility function that returns a choice whose name is the same as its value.
+func choice(value string) *discordgo.ApplicationCommandOptionChoice {
+	return &discordgo.ApplicationCommandOptionChoice{Name: value, Value: value}
+}
+
+// The completeEvents function suggests the categories of the upcoming events of the guild, soonest first, followed
+// by the aliases of the alias file, which are shown with what they expand to.
+func completeEvents(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	index, err := guildEvents(c.Guild)
+	if err != nil {
+		return
+	}
+	for _, e := range index.Between(time.Now(), time.Time{}) {
+		choices = append(choices, choice(e.Category))
+	}
+	aliases, err := store.Aliases()
+	if err != nil {
+		return
+	}
+	for _, a := range aliases {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: a.Alias + " (" + a.Value + ")", Value: a.Alias})
+	}
+	return
+}
+
+// The completeEventNumbers function suggests the numbers of the upcoming events of the guild, shown with the events,
+// as taken by the event command to edit or remove them.
+func completeEventNumbers(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	index, err := guildEvents(c.Guild)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	first := index.Number(now)
+	for i, e := range index.Between(now, time.Time{}) {
+		name := fmt.Sprintf("%d. %s %s %s (%s)", first+i, e.Category, e.Name, e.Session, e.Time.Format("2006-01-02 15:04 MST"))
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: strconv.Itoa(first + i)})
+	}
+	return
+}
+
+// The completeCategories function suggests the categories of every event of the guild.
+func completeCategories(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	index, err := guildEvents(c.Guild)
+	if err != nil {
+		return
+	}
+	for _, e := range index.Between(time.Time{}, time.Time{}) {
+		choices = append(choices, choice(e.Category))
+	}
+	return
+}
+
+// The completePeriods function suggests the periods of the events command, which also takes a number of days.
+func completePeriods(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	for _, period := range eventPeriods {
+		choices = append(choices, choice(period))
+	}
+	return
+}
+
+// The completeRoles function suggests the roles of the roles file of the guild, which users can add themselves to.
+func completeRoles(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	roles, err := store.Guild(c.Guild).Roles()
+	for _, r := range roles {
+		choices = append(choices, choice(r.Name))
+	}
+	return
+}
+
+// The completeDrivers function suggests the codes of the drivers of the drivers file, shown with their names.
+func completeDrivers(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	drivers, err := store.Drivers()
+	for _, d := range drivers {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: d.Code + " (" + d.Name + ")", Value: d.Code})
+	}
+	return
+}
+
+// The completeBet function suggests driver codes like completeDrivers, but also the other options of the bet command,
+// as they go on its first option.
+func completeBet(c Command, value string) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	choices, err := completeDrivers(c, value)
+	for _, option := range []string{"multipliers", "log", "points"} {
+		choices = append(choices, choice(option))
+	}
+	return choices, err
+}
+
+// The completeLanguages function suggests the codes of the languages there are templates for, shown with their names.
+func completeLanguages(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	for _, code := range languages(cfg()) {
+		name := localTemplates(c.Guild, code).Text("language", nil)
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: code + " (" + name + ")", Value: code})
+	}
+	return
+}
+
+// The completeTimezones function suggests the IANA time zones, like Europe/Lisbon, starting with the one of the user.
+func completeTimezones(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	u, err := store.User(c.User)
+	if err == nil {
+		choices = append(choices, choice(u.Timezone))
+	}
+	for _, zone := range timezones() {
+		choices = append(choices, choice(zone))
+	}
+	return choices, nil
+}
+
+// The timezones function returns the names of the IANA time zones found on the time zone database of the system.
+// Only the canonical Area/Location names are listed, as the rest are mostly kept for backward compatibility.
+func timezones() []string {
+	zonesOnce.Do(func() {
+		for _, dir := range []string{"/usr/share/zoneinfo", "/usr/lib/zoneinfo", "/usr/share/lib/zoneinfo"} {
+			filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return nil
+				}
+				name, _ := filepath.Rel(dir, path)
+				area, _, ok := strings.Cut(name, "/")
+				if !ok || !contains(zoneAreas, area) {
+					return nil
+				}
+				zones = append(zones, name)
+				return nil
+			})
+			if len(zones) > 0 {
+				break
+			}
+		}
+		zones = append(zones, "UTC")
+		sort.Strings(zones)
+	})
+	return zones
+}
+
+// The completeLocations function suggests the weather location saved by the user. The locations of other users
+// are never suggested, as they are personal data.
+func completeLocations(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	u, err := profile(c.User)
+	if err != nil {
+		return
+	}
+	if u.Location != "" {
+		choices = append(choices, choice(u.Location))
+	}
+	return
+}
+
+// The completeWeather function suggests the weather location saved by the user, as well as the units that the
+// weather command takes instead of a location.
+func completeWeather(c Command, value string) (choices []*discordgo.ApplicationCommandOptionChoice, err error) {
+	choices, err = completeLocations(c, value)
+	if err != nil {
+		return
+	}
+	tpl := userTemplates(c.Guild, c.User)
+	choices = append(choices,
+		&discordgo.ApplicationCommandOptionChoice{Name: tpl.Text("weather.choice_c", nil), Value: "c"},
+		&discordgo.ApplicationCommandOptionChoice{Name: tpl.Text("weather.choice_f", nil), Value: "f"},
+	)
+	return
+}
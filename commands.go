@@ -19,15 +19,16 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
 	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	owm "github.com/briandowns/openweathermap"
@@ -35,14 +36,18 @@ import (
 	"github.com/wcharczuk/go-chart"
 )
 
-// Slash commands are defined within a single var block instead of top level functions like regular commands.
-// The actual execution of slash commmands is done by the equivalent regular command functions defined below.
-// Slash commands are simple declarative boilerplate code to allow any regular commands to become slash ones.
-var (
-	commands = []*discordgo.ApplicationCommand{
+// Every built-in command is declared once on the registry below, from which both prefix and slash commands are derived.
+// The actual execution of the commands is done by the command functions defined below, through each Handler.
+// The registry is filled by init, as the help command reads it and Go doesn't allow that on its initialisation.
+var registry []*CommandSpec
+
+func init() {
+	registry = []*CommandSpec{
 		{
 			Name:        "ask",
+			Aliases:     []string{"a"},
 			Description: "Get a random answer for a question.",
+			Usage:       "<question>",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -51,10 +56,262 @@ var (
 					Required:    true,
 				},
 			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdAsk(s, c.Guild, c.Channel, c.User, c.Args)
+			},
+		},
+		{
+			Name:        "bet",
+			Aliases:     []string{"b"},
+			Description: "Bet on the podium of the next Formula 1 race.",
+			Usage:       "[<first> <second> <third>|multipliers|log|points]",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "first",
+					Description: "Driver code for the first place, or one of multipliers, log or points.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "second",
+					Description: "Driver code for the second place.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "third",
+					Description: "Driver code for the third place.",
+					Required:    false,
+				},
+			},
+			Complete: map[string]completer{"first": completeBet, "second": completeDrivers, "third": completeDrivers},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdBet(s, c.Guild, c.Channel, c.User, c.Args)
+			},
+		},
+		{
+			Name:        "calendar",
+			Aliases:     []string{"cal"},
+			Description: "Get the events as a calendar file and the link to subscribe to them on a calendar app.",
+			Usage:       "[category]",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "category",
+					Description: "Only include the events of this category.",
+					Required:    false,
+				},
+			},
+			Complete: map[string]completer{"category": completeCategories},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				category, _ := c.Options["category"].(string)
+				return cmdCalendar(s, c.Guild, c.Channel, c.User, category)
+			},
+		},
+		{
+			Name:        "disable",
+			Description: "Disable a command or plugin on a channel, on a category or on the whole server.",
+			Usage:       "[<command> [channel|category|server] [#channel]]",
+			Permission:  discordgo.PermissionManageServer,
+			Ephemeral:   true,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "command",
+					Description: "The command or plugin to disable, or none to list the disabled ones.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "scope",
+					Description: "Where to disable it (the channel by default).",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "channel", Value: "channel"},
+						{Name: "category", Value: "category"},
+						{Name: "server", Value: "server"},
+					},
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "The channel, or a channel of the category, to use instead of this one.",
+					Required:     false,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				},
+			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				command, _ := c.Options["command"].(string)
+				scope, _ := c.Options["scope"].(string)
+				channel, ok := c.Options["channel"].(string)
+				if !ok {
+					channel = c.Channel
+				}
+				return cmdDisable(s, c.Guild, channel, c.User, command, scope)
+			},
+		},
+		{
+			Name:        "enable",
+			Description: "Enable a command or plugin again on a channel, on a category or on the whole server.",
+			Usage:       "<command> [channel|category|server] [#channel]",
+			Permission:  discordgo.PermissionManageServer,
+			Ephemeral:   true,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "command",
+					Description: "The command or plugin to enable.",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "scope",
+					Description: "Where to enable it (the channel by default).",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "channel", Value: "channel"},
+						{Name: "category", Value: "category"},
+						{Name: "server", Value: "server"},
+					},
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "The channel, or a channel of the category, to use instead of this one.",
+					Required:     false,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				},
+			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				command, _ := c.Options["command"].(string)
+				scope, _ := c.Options["scope"].(string)
+				channel, ok := c.Options["channel"].(string)
+				if !ok {
+					channel = c.Channel
+				}
+				return cmdEnable(s, c.Guild, channel, c.User, command, scope)
+			},
+		},
+		{
+			Name:        "event",
+			Aliases:     []string{"ev"},
+			Description: "Add, edit, remove, list or import from a calendar the events announced by the bot.",
+			Usage:       "<add|edit|remove|list|import> [number|category|url] [category=] [name=] [session=] [date=] [channel=] [mention=] [image=]",
+			Permission:  discordgo.PermissionManageServer,
+			Ephemeral:   true,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "What to do with the events.",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "add", Value: "add"},
+						{Name: "edit", Value: "edit"},
+						{Name: "remove", Value: "remove"},
+						{Name: "list", Value: "list"},
+						{Name: "import", Value: "import"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "event",
+					Description: "Number of the event to edit or remove (see list), category to list or calendar URL to import.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "category",
+					Description: "Category of the event, like [Formula1].",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "name",
+					Description: "Name of the event, like Bahrain Grand Prix.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "session",
+					Description: "Session of the event, like Race.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "date",
+					Description: "Start of the event on your time zone, like 2026-03-01 15:00.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "channel",
+					Description: "Channel to announce the event on (the one of the category by default), or none.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "mention",
+					Description: "Role to mention on the announcement (the one of the category by default), or none.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "image",
+					Description: "URL of the image of the event (the one of the category by default), or none.",
+					Required:    false,
+				},
+			},
+			Complete: map[string]completer{"event": completeEventNumbers, "category": completeCategories},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				action, _ := c.Options["action"].(string)
+				number, _ := c.Options["event"].(string)
+				changes := make(map[string]interface{})
+				for name, value := range c.Options {
+					if name != "action" && name != "event" {
+						changes[name] = value
+					}
+				}
+				return cmdEvent(s, c.Guild, c.Channel, c.User, action, number, changes)
+			},
+		},
+		{
+			Name:        "events",
+			Aliases:     []string{"es"},
+			Description: "List the upcoming events by day on your time zone, for a category or period if you want.",
+			Usage:       "[category] [today|week|weekend|days]",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "category",
+					Description: "Only list the events of this category.",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "period",
+					Description: "Only list the events of today, the next 7 days, the next weekend or a number of days.",
+					Required:    false,
+				},
+			},
+			Complete: map[string]completer{"category": completeEvents, "period": completePeriods},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				category, _ := c.Options["category"].(string)
+				period, _ := c.Options["period"].(string)
+				// The period can also be the only argument, like !events weekend.
+				if period == "" && isEventPeriod(category) {
+					category, period = "", category
+				}
+				return cmdEvents(s, c.Guild, c.Channel, c.User, category, period)
+			},
 		},
 		{
 			Name:        "help",
+			Aliases:     []string{"h", "commands"},
 			Description: "Show help messages for each command.",
+			Usage:       "[command]",
+			Ephemeral:   true,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -63,10 +320,79 @@ var (
 					Required:    false,
 				},
 			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdHelp(s, c.Guild, c.Channel, c.User, strings.Join(c.Args, ""))
+			},
+		},
+		{
+			Name:        "language",
+			Aliases:     []string{"lang"},
+			Description: "Show or change the language the bot talks to you in.",
+			Usage:       "[code]",
+			Ephemeral:   true,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "code",
+					Description: "Code of the language, like en or pt.",
+					Required:    false,
+				},
+			},
+			Complete: map[string]completer{"code": completeLanguages},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdLanguage(s, c.Guild, c.Channel, c.User, strings.Join(c.Args, ""))
+			},
+		},
+		{
+			Name:        "mydata",
+			Description: "Export or delete the data the bot stores about you.",
+			Usage:       "<export|delete> [user] [format=json|zip]",
+			Cooldown:    time.Minute,
+			Ephemeral:   true,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "Whether to export your data or to delete it.",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "export", Value: "export"},
+						{Name: "delete", Value: "delete"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "Another user, like a member who left the server (bot admins only).",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "format",
+					Description: "Format of the export (JSON by default).",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "json", Value: "json"},
+						{Name: "zip", Value: "zip"},
+					},
+				},
+			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				action, _ := c.Options["action"].(string)
+				target, ok := c.Options["user"].(string)
+				if !ok {
+					target = c.User
+				}
+				format, _ := c.Options["format"].(string)
+				return cmdMyData(s, c.Guild, c.Channel, c.User, action, target, format)
+			},
 		},
 		{
 			Name:        "next",
+			Aliases:     []string{"n"},
 			Description: "Show the next upcoming event.",
+			Usage:       "[category]",
+			Ephemeral:   true,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -75,10 +401,16 @@ var (
 					Required:    false,
 				},
 			},
+			Complete: map[string]completer{"category": completeEvents},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdNext(s, c.Guild, c.Channel, c.User, strings.Join(c.Args, " "))
+			},
 		},
 		{
 			Name:        "ping",
+			Aliases:     []string{"p"},
 			Description: "Send a pong in reply to a ping.",
+			Usage:       "[target]",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -87,10 +419,58 @@ var (
 					Required:    false,
 				},
 			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdPing(s, c.Guild, c.Channel, c.User, c.Args)
+			},
+		},
+		{
+			Name:        "plugin",
+			Description: "Run one of the plugins of the bot.",
+			Usage:       "<plugin> [arguments]",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "plugin",
+					Description: "The name of the plugin to run.",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "arguments",
+					Description: "The arguments of the plugin.",
+					Required:    false,
+				},
+			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				name := strings.ToLower(c.Args[0])
+				tpl := userTemplates(c.Guild, c.User)
+				do := NewDiscordOutput(s, colorError, strings.ToUpper(name), "")
+				var args []string
+				if arguments, ok := c.Options["arguments"].(string); ok {
+					var err error
+					args, err = splitArgs(arguments)
+					if err != nil {
+						do.Description = tpl.Text("invalid_arguments", vars{"Error": err})
+						return do
+					}
+				}
+				// Plugins run this way can be disabled and have cooldowns just like when they are called by name.
+				if message := disabledHere(s, c.Guild, c.Channel, c.User, name); message != "" {
+					do.Description = message
+					return do
+				}
+				if wait := cooldownWait(name, c.User, c.Channel); wait > 0 {
+					do.Description = cooldownMessage(c.Guild, c.User, wait)
+					return do
+				}
+				cooldownRecord(name, c.User, c.Channel)
+				return cmdPlugin(name, s, c.Guild, c.Channel, c.User, args)
+			},
 		},
 		{
 			Name:        "poll",
 			Description: "Make a channel poll.",
+			Usage:       "<question> <option 1> <option 2> [option 3] [option 4] [option 5] [option 6] [duration=5m]",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -134,15 +514,86 @@ var (
 					Description: "Sixth option.",
 					Required:    false,
 				},
+				{
+					Type:        optionDuration,
+					Name:        "duration",
+					Description: "How long the poll is open, like 30m or 2h (5m by default).",
+					Required:    false,
+				},
+			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				var args []string
+				for _, name := range []string{"question", "option_1", "option_2", "option_3", "option_4", "option_5", "option_6"} {
+					if value, ok := c.Options[name].(string); ok {
+						args = append(args, value)
+					}
+				}
+				duration, ok := c.Options["duration"].(time.Duration)
+				if !ok {
+					duration = 5 * time.Minute
+				}
+				return cmdPoll(s, c.Guild, c.Channel, c.User, args, duration)
+			},
+		},
+		{
+			Name:        "processbets",
+			Aliases:     []string{"pb"},
+			Description: "Process the bets of the last race according to its results.",
+			AdminOnly:   true,
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdProcessBets(s, c.Guild, c.Channel, c.User)
+			},
+		},
+		{
+			Name:        "quote",
+			Aliases:     []string{"q"},
+			Description: "Show a random quote of this channel or add a new one.",
+			Usage:       "[get|add] [text]",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "Get a random quote or add a new one.",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "get", Value: "get"},
+						{Name: "add", Value: "add"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "text",
+					Description: "The text of the quote to add.",
+					Required:    false,
+				},
+			},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdQuote(s, c.Guild, c.Channel, c.User, c.Args)
 			},
 		},
 		{
 			Name:        "register",
+			Aliases:     []string{"r"},
 			Description: "Register your user on the bot.",
+			Ephemeral:   true,
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdRegister(s, c.Guild, c.Channel, c.User)
+			},
+		},
+		{
+			Name:        "reload",
+			Description: "Reload the configuration of the bot.",
+			Permission:  discordgo.PermissionManageServer,
+			Ephemeral:   true,
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdReload(s, c.Guild, c.Channel, c.User)
+			},
 		},
 		{
 			Name:        "roles",
+			Aliases:     []string{"ro"},
 			Description: "Add/remove user to/from server roles.",
+			Usage:       "[role]",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -151,325 +602,134 @@ var (
 					Required:    false,
 				},
 			},
+			Complete: map[string]completer{"role": completeRoles},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdRoles(s, c.Guild, c.Channel, c.User, c.Args)
+			},
 		},
 		{
-			Name:        "weather",
-			Description: "Show the current weather for a locattion.",
+			Name:        "settings",
+			Aliases:     []string{"se"},
+			Description: "Show or change your time zone, embeds, language and weather settings.",
+			Usage:       "[timezone] [embeds] [units] [language] [location]",
+			Ephemeral:   true,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "location",
-					Description: "Location for which you want to fetch the weather.",
+					Name:        "timezone",
+					Description: "Your time zone, like Europe/Lisbon.",
 					Required:    false,
 				},
-			},
-		},
-	}
-	commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
-		"ask": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdAsk(s, "", i.Member.User.ID, args)
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
-				},
-			})
-		},
-		"help": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdHelp(s, "", i.Member.User.ID, strings.Join(args, " "))
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
-					Flags:   1 << 6,
-				},
-			})
-		},
-		"next": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdNext(s, "", i.Member.User.ID, strings.Join(args, " "))
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
-					Flags:   1 << 6,
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "embeds",
+					Description: "Whether to show the output of the commands on embeds.",
+					Required:    false,
 				},
-			})
-		},
-		"ping": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdPing(s, "", i.Member.User.ID, args)
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "units",
+					Description: "Units of the weather.",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "c (Celsius)", Value: "c"},
+						{Name: "f (Fahrenheit)", Value: "f"},
+					},
 				},
-			})
-		},
-		"poll": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdPoll(s, "", i.Member.User.ID, args)
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "language",
+					Description: "Code of the language of the bot, like en or pt.",
+					Required:    false,
 				},
-			})
-			channel, _ := s.Channel(i.ChannelID)
-			pollMessageID := channel.LastMessageID
-			optionsUnicode := []string{"🇦", "🇧", "🇨", "🇩", "🇪", "🇫"}
-			for i := 0; i != len(options)-1; i++ {
-				s.MessageReactionAdd(channel.ID, pollMessageID, optionsUnicode[i])
-			}
-			go func() {
-				time.Sleep(5 * time.Minute)
-				results := make(map[string]int)
-				for i, v := range optionsUnicode {
-					users, err := s.MessageReactions(channel.ID, pollMessageID, v, 0, "", "")
-					if err != nil {
-						log.Println(err)
-					}
-					if len(users) > 0 {
-						results[fmt.Sprintf("%s - %s", v, args[i+1])] = len(users) - 1
-					}
-				}
-				scoreList := make(ScoreList, len(results))
-				i := 0
-				for k, v := range results {
-					scoreList[i] = Score{k, v}
-					i++
-				}
-				sort.Sort(sort.Reverse(scoreList))
-				s.ChannelMessageSend(channel.ID, "The poll has ended, here are the results:\n")
-				for _, v := range scoreList {
-					s.ChannelMessageSend(channel.ID, fmt.Sprintf("%s: %d votes\n", v.Key, v.Points))
-				}
-				err := s.MessageReactionsRemoveAll(channel.ID, pollMessageID)
-				if err != nil {
-					log.Println(err)
-				}
-			}()
-		},
-		"register": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			do := cmdRegister(s, "", i.Member.User.ID)
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
-					Flags:   1 << 6,
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "location",
+					Description: "Default location of the weather.",
+					Required:    false,
 				},
-			})
+			},
+			Complete: map[string]completer{"timezone": completeTimezones, "language": completeLanguages, "location": completeLocations},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdSettings(s, c.Guild, c.Channel, c.User, c.Options)
+			},
 		},
-		"roles": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdRoles(s, "", i.Member.User.ID, args)
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
-				},
-			})
+		{
+			Name:        "stats",
+			Aliases:     []string{"s"},
+			Description: "Show a chart with the number of messages sent by each user.",
+			Cooldown:    30 * time.Second,
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdStats(s, c.Guild, c.Channel, c.User)
+			},
 		},
-		"weather": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			var content string
-			var embed *discordgo.MessageEmbed
-			var embeds []*discordgo.MessageEmbed
-			var args []string
-			options := i.ApplicationCommandData().Options
-			for _, v := range options {
-				args = append(args, v.Value.(string))
-			}
-			do := cmdWeather(s, "", i.Member.User.ID, args)
-			if do.Embeds {
-				embed = do.Embed()
-				embeds = append(embeds, embed)
-			} else {
-				content = do.Text()
-			}
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: content,
-					Embeds:  embeds,
+		{
+			Name:        "weather",
+			Aliases:     []string{"w"},
+			Description: "Show the current weather for a locattion.",
+			Cooldown:    10 * time.Second,
+			Usage:       "[location|c|f]",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "location",
+					Description: "Location for which you want to fetch the weather.",
+					Required:    false,
 				},
-			})
+			},
+			Complete: map[string]completer{"location": completeWeather},
+			Handler: func(s *discordgo.Session, c Command) *DiscordOutput {
+				return cmdWeather(s, c.Guild, c.Channel, c.User, c.Args)
+			},
 		},
 	}
-)
+}
 
-// The findNext function receives a category and session and returns the chronologically next event matching that criteria.
-func findNext(category string, session string) (event []string, err error) {
-	var t time.Time
-	var timeFormat = "2006-01-02 15:04:05 UTC"
-	events, err := readCSV(eventsFile)
+// The findNext function receives a guild, a category and session and returns the chronologically next event of
+// that guild matching that criteria.
+func findNext(guild string, category string, session string) (event Event, err error) {
+	index, err := guildEvents(guild)
 	if err != nil {
 		return
 	}
-	// Loop through all events and get a parsed time for the event that matches the category and session criteria.
 	// There are 3 special cases where the category and session can be set to the wildcard any in different ways.
 	// Otherwise, use the default case to search for a specific category and session.
-	for _, e := range events {
-		switch {
-		case strings.ToLower(category) == "any" && strings.ToLower(session) == "any":
-			t, err = time.Parse(timeFormat, e[3])
-			if err != nil {
-				err = errors.New("error parsing time")
-				return event, err
-			}
-		case strings.ToLower(category) != "any" && strings.ToLower(session) == "any":
-			if strings.Contains(strings.ToLower(e[0]), strings.ToLower(category)) {
-				t, err = time.Parse(timeFormat, e[3])
-				if err != nil {
-					err = errors.New("error parsing time")
-					return event, err
-				}
-			}
-		case strings.ToLower(category) == "any" && strings.ToLower(session) != "any":
-			if strings.Contains(strings.ToLower(e[2]), strings.ToLower(session)) {
-				t, err = time.Parse(timeFormat, e[3])
-				if err != nil {
-					err = errors.New("error parsing time")
-					return event, err
-				}
-			}
-		default:
-			if strings.EqualFold(e[0], category) && strings.EqualFold(e[2], session) {
-				t, err = time.Parse(timeFormat, e[3])
-				if err != nil {
-					err = errors.New("error parsing time")
-					return event, err
-				}
-			}
-		}
-		// Get the time delta from now until the time of the event.
-		// If delta is equal or greater than zero, this is the next event that will happen.
-		delta := time.Until(t)
-		if delta >= 0 {
-			event = []string{e[0], e[1], e[2], e[3], e[4], e[5], e[6]}
-			return event, nil
-		}
+	now := time.Now()
+	var found bool
+	switch {
+	case strings.ToLower(category) == "any" && strings.ToLower(session) == "any":
+		event, found = index.Next(now, func(e Event) bool { return true })
+	case strings.ToLower(category) != "any" && strings.ToLower(session) == "any":
+		event, found = index.NextInCategory(category, now)
+	case strings.ToLower(category) == "any" && strings.ToLower(session) != "any":
+		event, found = index.NextInSession(session, now)
+	default:
+		event, found = index.Next(now, func(e Event) bool {
+			return strings.EqualFold(e.Category, category) && strings.EqualFold(e.Session, session)
+		})
+	}
+	if !found {
+		err = errors.New("no event found")
 	}
-	err = errors.New("no event found")
 	return
 }
 
 // The ask command receives a Discord session pointer, a channel and an arguments slice of strings.
 // It then checks if the user has asked a question and displays a random answer on the channel.
-func cmdAsk(dg *discordgo.Session, channel string, user string, args []string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "ASK", "")
-	users, err := readCSV(usersFile)
+func cmdAsk(dg *discordgo.Session, guild string, channel string, user string, args []string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("ask.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdAsk:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
+	do.Embeds = embeds
 	// Get a collection of answers stored as a CSV file.
-	answers, err := readCSV(answersFile)
-	if err != nil {
-		do.Description = ":warning: Error getting answer."
+	answers, err := store.Answers()
+	if err != nil || len(answers) == 0 {
+		do.Description = tpl.Text("ask.error", nil)
 		log.Println("cmdAsk:", err)
 		return
 	}
@@ -480,80 +740,76 @@ func cmdAsk(dg *discordgo.Session, channel string, user string, args []string) (
 	if len(args) > 0 {
 		rand.Seed(time.Now().UnixNano())
 		index := rand.Intn(len(answers))
-		do.Color = 0x3f82ef
-		do.Description = fmt.Sprintf("**Question:** %s\n\n**Answer:** %s", strings.Join(args, " "), answers[index][0])
+		do.Color = colorInfo
+		do.Description = tpl.Text("ask.answer", vars{"Question": strings.Join(args, " "), "Answer": answers[index]})
 		// Otherwise, if we get here, it means the user didn't use the command correctly.
 		// Ttherefore we show a usage message on the channel.
 	} else {
-		do.Description = ":warning: Usage: !ask <question>"
+		do.Description = tpl.Text("ask.usage", vars{"Prefix": cfg().guild(guild).Prefix})
 	}
 	return
 }
 
-// The bet command receives a Discord session pointer, a channel, a user and a bet containing 3 drivers.
+// The bet command receives a Discord session pointer, a guild, a channel, a user and a bet containing 3 drivers.
 // It then stores the bet provided by the user, or lets the user know his current bet for the next race.
-func cmdBet(dg *discordgo.Session, channel string, user string, bet []string) (do *DiscordOutput) {
+func cmdBet(dg *discordgo.Session, guild string, channel string, user string, bet []string) (do *DiscordOutput) {
 	var correct int
-	var bets [][]string
-	var update bool
-	do = NewDiscordOutput(dg, 0xb40000, "BET", "")
-	users, err := readCSV(usersFile)
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("bet.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdAsk:", err)
-		return
-	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
-	users, err = readCSV(betFile)
-	if err != nil {
-		do.Description = ":warning: Error getting users."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdBet:", err)
 		return
 	}
-	if !isUser(user, users) {
-		users = append(users, []string{strings.ToLower(user), "Europe/Berlin", ""})
-		err = writeCSV(betFile, users)
-		if err != nil {
-			do.Description = ":warning: Error registering user to the bet command."
-			log.Println("cmdBet:", err)
-			return
+	do.Embeds = embeds
+	st := store.Guild(guild)
+	// Register the user to the bet command the first time he uses it.
+	err = st.UpdateBettors(func(bettors []Bettor) ([]Bettor, error) {
+		for _, b := range bettors {
+			if strings.EqualFold(b.ID, user) {
+				return nil, ErrNoChange
+			}
 		}
-	}
-	event, err := findNext("[formula 1]", "race")
+		return append(bettors, Bettor{ID: strings.ToLower(user)}), nil
+	})
 	if err != nil {
-		do.Description = ":warning: Bets are closed."
+		do.Description = tpl.Text("bet.error_registering", nil)
 		log.Println("cmdBet:", err)
 		return
 	}
-	bets, err = readCSV(betsFile)
+	event, err := findNext(guild, "[formula 1]", "race")
 	if err != nil {
-		do.Description = ":warning: Error getting bets."
+		do.Description = tpl.Text("bet.closed", nil)
 		log.Println("cmdBet:", err)
 		return
 	}
 	// If no bet is provided as argument, we simply show the user's current bet, if he's placed one.
+	// A button lets users place or change their bet on a form instead of typing the driver codes.
 	if len(bet) == 0 {
-		for i := len(bets) - 1; i >= 0; i-- {
-			if strings.ToLower(bets[i][0]) == strings.ToLower(event[1]) && strings.ToLower(bets[i][1]) == strings.ToLower(user) {
-				first := strings.ToUpper(bets[i][2])
-				second := strings.ToUpper(bets[i][3])
-				third := strings.ToUpper(bets[i][4])
-				do.Description = fmt.Sprintf("Your current bet for the %s: %s %s %s", event[1], first, second, third)
-				return
-			}
+		do.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: tpl.Text("bet.button", nil), Style: discordgo.PrimaryButton, CustomID: "bet"},
+				},
+			},
+		}
+		current, err := st.Bet(event.Name, user)
+		if errors.Is(err, ErrNotFound) {
+			do.Description = tpl.Text("bet.none", vars{"Race": event.Name, "Prefix": cfg().guild(guild).Prefix})
+			return
 		}
-		do.Description = fmt.Sprintf("You haven't placed a bet for the %s yet.\nUse !bet log to check older bets.", event[1])
+		if err != nil {
+			do.Description = tpl.Text("bet.error_bets", nil)
+			log.Println("cmdBet:", err)
+			return
+		}
+		do.Description = tpl.Text("bet.current", vars{"Race": event.Name, "Drivers": current.Drivers[:]})
 		return
 	}
-	drivers, err := readCSV(driversFile)
+	drivers, err := store.Drivers()
 	if err != nil {
-		do.Description = ":warning: Error getting drivers."
+		do.Description = tpl.Text("error.drivers", nil)
 		log.Println("cmdBet:", err)
 		return
 	}
@@ -565,23 +821,9 @@ func cmdBet(dg *discordgo.Session, channel string, user string, bet []string) (d
 		switch strings.ToLower(bet[0]) {
 		case "multipliers", "odds":
 			var output string
-			odds, err := toStringMap(drivers, 1, 2)
-			if err != nil {
-				do.Description = ":warning: Error getting odds."
-				log.Println("cmdBet:", err)
-				return
-			}
-			scoreList := make(ScoreList, len(drivers))
-			i := 0
-			for k, v := range odds {
-				integerOdds, err := strconv.Atoi(v)
-				if err != nil {
-					do.Description = ":warning: Error getting odds."
-					log.Println("cmdBet:", err)
-					return
-				}
-				scoreList[i] = Score{k, integerOdds}
-				i++
+			scoreList := make(ScoreList, 0, len(drivers))
+			for _, d := range drivers {
+				scoreList = append(scoreList, Score{d.Code, d.Odds})
 			}
 			sort.Sort(scoreList)
 			for _, v := range scoreList {
@@ -589,37 +831,43 @@ func cmdBet(dg *discordgo.Session, channel string, user string, bet []string) (d
 			}
 			if len(output) > 3 {
 				do.Description = output
+				do.Paginate = true
 			}
 		case "log":
+			bets, err := st.Bets()
+			if err != nil {
+				do.Description = tpl.Text("bet.error_bets", nil)
+				log.Println("cmdBet:", err)
+				return
+			}
 			var betsFound bool
 			var counter int
 			for i := len(bets) - 1; i >= 0 && counter < 3; i-- {
-				if strings.ToLower(bets[i][1]) == strings.ToLower(user) {
+				if strings.EqualFold(bets[i].User, user) {
 					betsFound = true
-					do.Description =
-						fmt.Sprintf("Your bet for the %s: %s %s %s %s points.",
-							bets[i][0],
-							strings.ToUpper(bets[i][2]),
-							strings.ToUpper(bets[i][3]),
-							strings.ToUpper(bets[i][4]),
-							bets[i][5])
+					do.Description = tpl.Text("bet.log", vars{"Race": bets[i].Race, "Drivers": bets[i].Drivers[:], "Points": bets[i].Points})
 					counter += 1
 				}
 			}
 			if !betsFound {
-				do.Description = ":warning: No recent bets from you."
+				do.Description = tpl.Text("bet.no_recent", nil)
 			}
 		case "points":
-			scoreList := make(ScoreList, len(users))
-			for _, user := range users {
-				points, _ := strconv.Atoi(user[2])
-				if points > 0 {
-					member, err := dg.GuildMember(guild, user[0])
+			bettors, err := st.Bettors()
+			if err != nil {
+				do.Description = tpl.Text("error.users", nil)
+				log.Println("cmdBet:", err)
+				return
+			}
+			scoreList := make(ScoreList, 0, len(bettors))
+			for _, bettor := range bettors {
+				if bettor.Points > 0 {
+					member, err := dg.GuildMember(guild, bettor.ID)
 					if err != nil {
 						log.Println("cmdBet:", err)
 						continue
 					}
-					scoreList = append(scoreList, Score{member.User.Username, points})
+					scoreList = append(scoreList, Score{member.User.Username, bettor.Points})
 				}
 			}
 			sort.Sort(sort.Reverse(scoreList))
@@ -631,14 +879,15 @@ func cmdBet(dg *discordgo.Session, channel string, user string, bet []string) (d
 			}
 			if len(output) > 3 {
 				do.Description = output
+				do.Paginate = true
 			}
 		default:
-			do.Description = ":warning: Unknown command option."
+			do.Description = tpl.Text("bet.unknown_option", nil)
 		}
 		return
 	}
 	if len(bet) != 3 {
-		do.Description = ":warning: The bet must contain 3 drivers."
+		do.Description = tpl.Text("bet.three_drivers", nil)
 		return
 	}
 	// Finally, if we reach this point, it means the user has provided a valid bet composed of 3 drivers.
@@ -648,100 +897,639 @@ func cmdBet(dg *discordgo.Session, channel string, user string, bet []string) (d
 	second := strings.ToLower(bet[1])
 	third := strings.ToLower(bet[2])
 	for _, driver := range drivers {
-		code := strings.ToLower(driver[1])
+		code := strings.ToLower(driver.Code)
 		if code == first || code == second || code == third {
 			correct++
 		}
 	}
-	if correct != 3 {
-		do.Description = ":warning: Invalid drivers."
+	if correct != 3 {
+		do.Description = tpl.Text("bet.invalid_drivers", nil)
+		return
+	}
+	newBet := Bet{Race: event.Name, User: strings.ToLower(user), Drivers: [3]string{first, second, third}}
+	err = st.UpdateBets(func(bets []Bet) ([]Bet, error) {
+		for i := 0; i < len(bets); i++ {
+			if strings.EqualFold(bets[i].Race, event.Name) && strings.EqualFold(bets[i].User, user) {
+				bets[i] = newBet
+				return bets, nil
+			}
+		}
+		return append(bets, newBet), nil
+	})
+	if err != nil {
+		do.Description = tpl.Text("bet.error_updating", nil)
+		log.Println("cmdBet:", err)
+		return
+	}
+	do.Color = colorInfo
+	do.Description = tpl.Text("bet.updated", vars{"Race": event.Name})
+	return
+}
+
+// The calendar command receives a Discord session pointer, a guild, a channel, a user and an optional category.
+// It then replies with the upcoming events of the guild as an iCalendar file and, if the bot serves the calendar
+// feed (see CalendarConfig), with its link, which calendar apps can subscribe to.
+func cmdCalendar(dg *discordgo.Session, guild string, channel string, user string, category string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("calendar.title", nil), "")
+	embeds, err := embedsEnabled(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdCalendar:", err)
+		return
+	}
+	do.Embeds = embeds
+	index, err := guildEvents(guild)
+	if err != nil {
+		do.Description = tpl.Text("calendar.error", nil)
+		log.Println("cmdCalendar:", err)
+		return
+	}
+	var file bytes.Buffer
+	err = writeICS(&file, guild, index.Between(time.Now(), time.Time{}), category)
+	if err != nil {
+		do.Description = tpl.Text("calendar.error", nil)
+		log.Println("cmdCalendar:", err)
+		return
+	}
+	do.Color = colorInfo
+	do.Description = tpl.Text("calendar.file", vars{"URL": calendarURL(guild, category), "Category": category})
+	do.Files = []*discordgo.File{{Name: "events.ics", ContentType: "text/calendar", Reader: &file}}
+	return
+}
+
+// The disable command receives a Discord session pointer, a guild, a channel, a user, a command and a scope.
+// It then disables the command on the channel, on its category or on the server, according to the scope.
+// Without a command, it lists the commands disabled on the server instead.
+func cmdDisable(dg *discordgo.Session, guild string, channel string, user string, command string, scope string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("disable.title", nil), "")
+	embeds, err := embedsEnabled(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdDisable:", err)
+		return
+	}
+	do.Embeds = embeds
+	if guild == "" {
+		do.Description = tpl.Text("disable.not_server", nil)
+		return
+	}
+	if command == "" {
+		disabled, err := disabledCommands(guild)
+		if err != nil {
+			do.Description = tpl.Text("disable.error_list", nil)
+			log.Println("cmdDisable:", err)
+			return
+		}
+		var list string
+		for _, v := range cfg().guild(guild).Disabled {
+			list += tpl.Text("disable.list_config", vars{"Command": v}) + "\n"
+		}
+		for _, d := range disabled {
+			// Channels and categories of other guilds sharing the same disabled file are left out.
+			if d.Scope == "guild" && d.ID != "" && d.ID != guild {
+				continue
+			}
+			if ch, err := dg.State.Channel(d.ID); d.Scope != "guild" && err == nil && ch.GuildID != guild {
+				continue
+			}
+			list += tpl.Text("disable.list_entry", vars{"Command": d.Command, "Where": describeEntry(tpl, d)}) + "\n"
+		}
+		do.Color = colorInfo
+		if list == "" {
+			do.Description = tpl.Text("disable.none", nil)
+			return
+		}
+		do.Description = tpl.Text("disable.list", vars{"List": list})
+		do.Paginate = true
+		return
+	}
+	name, ok := commandName(command)
+	if !ok {
+		do.Description = tpl.Text("error.no_command", vars{"Command": command})
+		return
+	}
+	if name == "disable" || name == "enable" {
+		do.Description = tpl.Text("disable.not_allowed", vars{"Command": name})
+		return
+	}
+	entry, err := disabledEntry(dg, guild, channel, name, scope)
+	if err != nil {
+		do.Description = tpl.Text("disable.error_category", vars{"Error": err})
+		return
+	}
+	err = updateDisabled(guild, func(disabled []DisabledCommand) ([]DisabledCommand, error) {
+		for _, d := range disabled {
+			if strings.EqualFold(d.Command, entry.Command) && d.Scope == entry.Scope && d.ID == entry.ID {
+				do.Description = tpl.Text("disable.already", vars{"Command": name, "Where": describeEntry(tpl, entry)})
+				return nil, ErrNoChange
+			}
+		}
+		return append(disabled, entry), nil
+	})
+	if err != nil {
+		do.Description = tpl.Text("disable.error", nil)
+		log.Println("cmdDisable:", err)
+		return
+	}
+	if do.Description != "" {
+		return
+	}
+	do.Color = colorInfo
+	do.Description = tpl.Text("disable.done", vars{"Command": name, "Where": describeEntry(tpl, entry)})
+	return
+}
+
+// The enable command receives a Discord session pointer, a guild, a channel, a user, a command and a scope.
+// It then enables the command again on the channel, on its category or on the server, according to the scope.
+func cmdEnable(dg *discordgo.Session, guild string, channel string, user string, command string, scope string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("enable.title", nil), "")
+	embeds, err := embedsEnabled(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdEnable:", err)
+		return
+	}
+	do.Embeds = embeds
+	if guild == "" {
+		do.Description = tpl.Text("enable.not_server", nil)
+		return
+	}
+	name, ok := commandName(command)
+	if !ok {
+		do.Description = tpl.Text("error.no_command", vars{"Command": command})
+		return
+	}
+	entry, err := disabledEntry(dg, guild, channel, name, scope)
+	if err != nil {
+		do.Description = tpl.Text("enable.error_category", vars{"Error": err})
+		return
+	}
+	err = updateDisabled(guild, func(disabled []DisabledCommand) ([]DisabledCommand, error) {
+		var kept []DisabledCommand
+		for _, d := range disabled {
+			// Rows of older versions disable the command on the whole server, just like the server scope.
+			same := d.Scope == entry.Scope && (d.ID == entry.ID || entry.Scope == "guild" && d.ID == "")
+			if !strings.EqualFold(d.Command, entry.Command) || !same {
+				kept = append(kept, d)
+			}
+		}
+		if len(kept) == len(disabled) {
+			do.Description = tpl.Text("enable.not_disabled", vars{"Command": name, "Where": describeEntry(tpl, entry)})
+			return nil, ErrNoChange
+		}
+		return kept, nil
+	})
+	if err != nil {
+		do.Description = tpl.Text("enable.error", nil)
+		log.Println("cmdEnable:", err)
+		return
+	}
+	if do.Description != "" {
+		return
+	}
+	do.Color = colorInfo
+	do.Description = tpl.Text("enable.done", vars{"Command": name, "Where": describeEntry(tpl, entry)})
+	// The command may still be disabled on a wider scope, which is worth telling.
+	if message := disabledHere(dg, guild, channel, user, name); message != "" {
+		do.Description += "\n\n" + message
+	}
+	return
+}
+
+// The componentBet function handles the button shown by the bet command and the form it opens.
+// The button shows a form with the current bet of whoever clicked it, whose submission places the bet like the
+// bet command does, replying only to that user.
+func componentBet(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	user := interactionUser(i)
+	tpl := userTemplates(i.GuildID, user)
+	if i.Type == discordgo.InteractionModalSubmit {
+		values := modalValues(i)
+		drivers := []string{values["first"], values["second"], values["third"]}
+		respond(s, i, true, func() *DiscordOutput {
+			return cmdBet(s, i.GuildID, i.ChannelID, user, drivers)
+		})
+		return
+	}
+	event, err := findNext(i.GuildID, "[formula 1]", "race")
+	if err != nil {
+		respondText(s, i, tpl.Text("bet.closed", nil))
+		return
+	}
+	var current [3]string
+	bet, err := store.Guild(i.GuildID).Bet(event.Name, user)
+	if err == nil {
+		current = bet.Drivers
+	}
+	var inputs []discordgo.TextInput
+	for position, name := range []string{"first", "second", "third"} {
+		inputs = append(inputs, discordgo.TextInput{
+			CustomID:    name,
+			Label:       tpl.Text("bet.input", vars{"Position": name}),
+			Style:       discordgo.TextInputShort,
+			Placeholder: "VER",
+			Value:       strings.ToUpper(current[position]),
+			Required:    true,
+		})
+	}
+	showModal(s, i, "bet", truncate(tpl.Text("bet.form", vars{"Race": event.Name}), 45), inputs...)
+}
+
+// The event command receives a Discord session pointer, a guild, a channel, a user, an action, the number of an event
+// and the fields to change. It then adds, edits or removes an event of the guild, or lists the upcoming ones.
+// Dates are typed and shown on the time zone of the user, while the events file keeps them in UTC, sorted by date.
+// Events are numbered by their position on the event index (see EventIndex), past ones included.
+// The import action takes the URL of an iCalendar file instead of a number, whose events are added (see importICS).
+func cmdEvent(dg *discordgo.Session, guild string, channel string, user string, action string, number string, changes map[string]interface{}) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("event.title", nil), "")
+	u, err := profile(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdEvent:", err)
+		return
+	}
+	do.Embeds = u.Embeds
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		do.Description = tpl.Text("event.error_timezone", nil)
+		log.Println("cmdEvent:", err)
+		return
+	}
+	if action == "list" {
+		index, err := guildEvents(guild)
+		if err != nil {
+			do.Description = tpl.Text("event.error", nil)
+			log.Println("cmdEvent:", err)
+			return
+		}
+		// The numbers are the positions on the event index, which edit and remove take.
+		var list string
+		now := time.Now()
+		first := index.Number(now)
+		for i, e := range index.Between(now, time.Time{}) {
+			if !strings.Contains(strings.ToLower(e.Category), strings.ToLower(number)) {
+				continue
+			}
+			list += tpl.Text("event.list_entry", vars{"Number": first + i, "Event": e, "Time": e.Time.In(loc)}) + "\n"
+		}
+		do.Color = colorInfo
+		if list == "" {
+			do.Description = tpl.Text("event.none", nil)
+			return
+		}
+		do.Description = tpl.Text("event.list", vars{"List": list})
+		do.Paginate = true
+		return
+	}
+	if action == "import" {
+		category, _ := changes["category"].(string)
+		imported, err := fetchICS(number)
+		if err != nil {
+			do.Description = tpl.Text("event.error_import", vars{"Error": err})
+			log.Println("cmdEvent:", err)
+			return
+		}
+		var added, updated, skipped int
+		err = updateEvents(guild, func(events []Event) ([]Event, error) {
+			events, added, updated, skipped = importICS(guild, events, imported, strings.TrimSpace(category))
+			if added == 0 && updated == 0 {
+				return nil, ErrNoChange
+			}
+			return events, nil
+		})
+		if err != nil {
+			do.Description = tpl.Text("event.error", nil)
+			log.Println("cmdEvent:", err)
+			return
+		}
+		do.Color = colorInfo
+		do.Description = tpl.Text("event.import_done", vars{"Added": added, "Updated": updated, "Skipped": skipped})
+		return
+	}
+	if action != "add" && number == "" {
+		do.Description = tpl.Text("event.no_number", vars{"Prefix": cfg().guild(guild).Prefix})
+		return
+	}
+	// The numbers are the positions on the event index, so the event is looked up on the events file by its fields,
+	// in case the file changed since it was listed.
+	var event Event
+	if action != "add" {
+		index, err := guildEvents(guild)
+		if err != nil {
+			do.Description = tpl.Text("event.error", nil)
+			log.Println("cmdEvent:", err)
+			return
+		}
+		event, err = index.Event(number)
+		if err != nil {
+			do.Description = tpl.Text("event.not_found", vars{"Number": number, "Prefix": cfg().guild(guild).Prefix})
+			return
+		}
+	}
+	err = updateEvents(guild, func(events []Event) ([]Event, error) {
+		position := -1
+		if action != "add" {
+			position = findEvent(events, event)
+			if position < 0 {
+				do.Description = tpl.Text("event.not_found", vars{"Number": number, "Prefix": cfg().guild(guild).Prefix})
+				return nil, ErrNoChange
+			}
+		}
+		if action == "remove" {
+			return append(events[:position], events[position+1:]...), nil
+		}
+		if len(changes) == 0 {
+			do.Description = tpl.Text("event.no_changes", nil)
+			return nil, ErrNoChange
+		}
+		// New events take the channel, image and mention of their category unless they are given others.
+		if action == "add" {
+			category, _ := changes["category"].(string)
+			defaults := categoryDefaults(events, strings.TrimSpace(category))
+			event = Event{Channel: defaults.Channel, Image: defaults.Image, Mention: defaults.Mention}
+		}
+		err := applyEventChanges(&event, changes, loc)
+		if err != nil {
+			do.Description = tpl.Text("event.invalid", vars{"Error": err})
+			return nil, ErrNoChange
+		}
+		if duplicateEvent(events, event, position) {
+			do.Description = tpl.Text("event.duplicate", nil)
+			return nil, ErrNoChange
+		}
+		if action == "add" {
+			return append(events, event), nil
+		}
+		events[position] = event
+		return events, nil
+	})
+	if err != nil {
+		do.Description = tpl.Text("event.error", nil)
+		log.Println("cmdEvent:", err)
+		return
+	}
+	if do.Description != "" {
+		return
+	}
+	t := event.Time.In(loc)
+	zone, _ := t.Zone()
+	do.Color = colorInfo
+	do.Description = tpl.Text("event."+action+"_done", vars{"Event": event, "Time": t, "Zone": zone})
+	return
+}
+
+// The events command receives a Discord session pointer, a guild, a channel, a user, a category and a period.
+// It then lists the upcoming events of the guild matching them, grouped by day on the time zone of the user.
+// Categories can be abbreviated with the aliases of the alias file, like on the next command.
+func cmdEvents(dg *discordgo.Session, guild string, channel string, user string, category string, period string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("events.title", nil), "")
+	u, err := profile(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdEvents:", err)
+		return
+	}
+	do.Embeds = u.Embeds
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		do.Description = tpl.Text("event.error_timezone", nil)
+		log.Println("cmdEvents:", err)
+		return
+	}
+	from, to, err := eventPeriod(period, time.Now().In(loc))
+	if err != nil {
+		do.Description = tpl.Text("events.invalid_period", vars{"Error": err})
 		return
 	}
-	for i := 0; i < len(bets); i++ {
-		if strings.ToLower(bets[i][0]) == strings.ToLower(event[1]) && strings.ToLower(bets[i][1]) == strings.ToLower(user) {
-			update = true
-			bets[i] = []string{event[1], strings.ToLower(user), first, second, third, "0"}
-			break
+	if category != "" {
+		if result, err := lookupAlias(category); err == nil {
+			category = result
 		}
 	}
-	if !update {
-		bets = append(bets, []string{event[1], strings.ToLower(user), first, second, third, "0"})
-	}
-	err = writeCSV(betsFile, bets)
+	index, err := guildEvents(guild)
 	if err != nil {
-		do.Description = ":warning: Error updating bet."
-		log.Println("cmdBet:", err)
+		do.Description = tpl.Text("event.error", nil)
+		log.Println("cmdEvents:", err)
+		return
+	}
+	// Each day is a field, holding a line per event.
+	fields := []map[string]string{}
+	day := ""
+	for _, e := range index.Between(from, to) {
+		if !strings.Contains(strings.ToLower(e.Category), strings.ToLower(category)) {
+			continue
+		}
+		t := e.Time.In(loc)
+		if t.Format("2006-01-02") != day {
+			day = t.Format("2006-01-02")
+			fields = append(fields, map[string]string{"Name": tpl.Text("events.day", vars{"Time": t}), "Value": ""})
+		}
+		field := fields[len(fields)-1]
+		field["Value"] += tpl.Text("events.entry", vars{"Event": e, "Time": t}) + "\n"
+	}
+	data := vars{"Category": category, "Period": period, "Timezone": u.Timezone}
+	if len(fields) == 0 {
+		do.Description = tpl.Text("events.none", data)
 		return
 	}
-	do.Color = 0x3f82ef
-	do.Description = "Your bet for the " + event[1] + " was successfully updated."
+	do.Color = colorInfo
+	do.Description = tpl.Text("events.header", data) + "\n"
+	do.Fields = &fields
+	do.Paginate = true
 	return
 }
 
-// The help command receives a Discord session pointer, a channel and a search string.
+// The help command receives a Discord session pointer, a guild, a channel and a search string.
 // It then shows a compact help message listing all the possible commands of the bot.
-func cmdHelp(dg *discordgo.Session, channel string, user string, search string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "HELP", "")
-	users, err := readCSV(usersFile)
+func cmdHelp(dg *discordgo.Session, guild string, channel string, user string, search string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("help.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdHelp:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
-	// Get a collection of usage strings stored as a CSV file.
-	usage, err := readCSV(usageFile)
+	do.Embeds = embeds
+	// The help of built-in commands comes from the registry, while plugins are documented on the usage file.
+	// Entries of the usage file for built-in commands are ignored, as the registry is always up to date.
+	usage, err := store.Usage()
 	if err != nil {
-		do.Description = ":warning: Error getting usage messages."
+		do.Description = tpl.Text("help.error", nil)
 		log.Println("cmdHelp:", err)
 		return
 	}
+	prefix := cfg().guild(guild).Prefix
 	if search == "" {
 		var commandList string
+		for _, spec := range registry {
+			commandList += prefix + spec.Name + "\n"
+		}
 		for _, v := range usage {
-			commandList += prefix + v[0] + "\n"
+			if _, ok := lookupCommand(v.Command); !ok {
+				commandList += prefix + v.Command + "\n"
+			}
 		}
-		do.Description = commandList + "\n\nUse " + prefix + "help [command] to get help for a specific command."
+		do.Description = tpl.Text("help.list", vars{"List": commandList, "Prefix": prefix})
+		do.Paginate = true
 	} else {
+		if spec, ok := lookupCommand(search); ok {
+			do.Description = spec.usageText(tpl, prefix)
+			return
+		}
 		for _, v := range usage {
-			if strings.EqualFold(v[0], search) {
-				do.Description = prefix + v[1]
+			if strings.EqualFold(v.Command, search) {
+				do.Description = prefix + v.Text
 				return
 			}
 		}
-		do.Description = ":warning: Command not found."
+		do.Description = tpl.Text("help.not_found", nil)
+	}
+	return
+}
+
+// The language command receives a Discord session pointer, a guild, a channel, a user and an optional language code.
+// It then shows the language of the user and the available ones or changes the language of the user.
+func cmdLanguage(dg *discordgo.Session, guild string, channel string, user string, code string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("language.title", nil), "")
+	embeds, err := embedsEnabled(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdLanguage:", err)
+		return
+	}
+	do.Embeds = embeds
+	available := languages(cfg())
+	if code == "" {
+		do.Color = colorInfo
+		do.Description = tpl.Text("language.current", vars{"Language": language(guild, user), "Available": available})
+		return
+	}
+	code = strings.ToLower(code)
+	if !contains(available, code) {
+		do.Description = tpl.Text("language.unknown", vars{"Language": code, "Available": available})
+		return
+	}
+	err = updateProfile(user, func(u *User) {
+		u.Language = code
+	})
+	if err != nil {
+		do.Description = tpl.Text("language.error", nil)
+		log.Println("cmdLanguage:", err)
+		return
+	}
+	// The confirmation is already written in the new language.
+	tpl = userTemplates(guild, user)
+	do.Title = tpl.Text("language.title", nil)
+	do.Color = colorInfo
+	do.Description = tpl.Text("language.changed", vars{"Language": code})
+	return
+}
+
+// The mydata command receives a Discord session pointer, a guild, a channel, a user, an action, a target user and
+// the format of the export. It then sends the user a DM with everything the bot stores about the target or, to
+// delete that data, asks the user to confirm it with a button (see componentMyData).
+// Users can only export or delete their own data, except for the bot admins, who can do it for anyone.
+func cmdMyData(dg *discordgo.Session, guild string, channel string, user string, action string, target string, format string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("mydata.title", nil), "")
+	embeds, err := embedsEnabled(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdMyData:", err)
+		return
+	}
+	do.Embeds = embeds
+	if !strings.EqualFold(target, user) && !contains(cfg().Admins, user) {
+		do.Description = tpl.Text("mydata.not_admin", nil)
+		return
+	}
+	if action == "delete" {
+		do.Description = tpl.Text("mydata.confirm", vars{"User": target, "Self": strings.EqualFold(target, user)})
+		do.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: tpl.Text("mydata.button", nil), Style: discordgo.DangerButton, CustomID: "mydata:" + target},
+				},
+			},
+		}
+		return
+	}
+	data, err := collectUserData(target)
+	if err != nil {
+		do.Description = tpl.Text("mydata.error", nil)
+		log.Println("cmdMyData:", err)
+		return
+	}
+	file, err := exportFile(data, format)
+	if err != nil {
+		do.Description = tpl.Text("mydata.error", nil)
+		log.Println("cmdMyData:", err)
+		return
+	}
+	// The export is sent to the user who asked for it, even when it is the data of someone else.
+	dm, err := dg.UserChannelCreate(user)
+	if err == nil {
+		export := NewDiscordOutput(dg, colorInfo, tpl.Text("mydata.title", nil), tpl.Text("mydata.export", vars{"User": target}))
+		export.Embeds = embeds
+		export.Files = []*discordgo.File{file}
+		_, err = (&Reply{Session: dg, Guild: guild, User: user, Channel: dm.ID}).Send(export)
+	}
+	if err != nil {
+		do.Description = tpl.Text("mydata.error_dm", nil)
+		log.Println("cmdMyData:", err)
+		return
 	}
+	do.Color = colorInfo
+	do.Description = tpl.Text("mydata.exported", nil)
 	return
 }
 
-// The next command receives a Discord session pointer, a channel, a user and an optional search string.
+// The componentMyData function handles the button shown by the mydata command to confirm deleting the data of a
+// user, which only that user or a bot admin can click.
+func componentMyData(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	user := interactionUser(i)
+	tpl := userTemplates(i.GuildID, user)
+	if len(args) == 0 || (!strings.EqualFold(args[0], user) && !contains(cfg().Admins, user)) {
+		respondText(s, i, tpl.Text("mydata.not_admin", nil))
+		return
+	}
+	target := args[0]
+	respond(s, i, true, func() *DiscordOutput {
+		do := NewDiscordOutput(s, colorError, tpl.Text("mydata.title", nil), "")
+		do.Embeds, _ = embedsEnabled(user)
+		err := deleteUserData(target)
+		if err != nil {
+			do.Description = tpl.Text("mydata.error", nil)
+			log.Println("componentMyData:", err)
+			return do
+		}
+		do.Color = colorInfo
+		do.Description = tpl.Text("mydata.deleted", vars{"User": target, "Self": strings.EqualFold(target, user)})
+		return do
+	})
+}
+
+// The next command receives a Discord session pointer, a guild, a channel, a user and an optional search string.
 // It then queries the events CSV file and returns which event is happening next, showing it on the channel.
-func cmdNext(dg *discordgo.Session, channel string, user string, search string) (do *DiscordOutput) {
-	var tz = "Europe/Berlin"
-	var event []string
-	var timeFormat = "2006-01-02 15:04:05 UTC"
+func cmdNext(dg *discordgo.Session, guild string, channel string, user string, search string) (do *DiscordOutput) {
+	var event Event
 	var image string
-	do = NewDiscordOutput(dg, 0xb40000, "NEXT", "")
-	users, err := readCSV(usersFile)
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("next.title", nil), "")
+	u, err := profile(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdNext:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			tz = u[1]
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
+	tz := u.Timezone
+	do.Embeds = u.Embeds
 	// Do some search string replacements in case there's actually a search argument.
 	// Users use abreviated search terms, which are expanded for better database matching.
 	// Retrieve the next event matching category or session criteria.
@@ -750,71 +1538,66 @@ func cmdNext(dg *discordgo.Session, channel string, user string, search string)
 		result := ""
 		result, err = lookupAlias(search)
 		if err != nil {
-			event, err = findNext(search, "any")
+			event, err = findNext(guild, search, "any")
 		} else {
-			event, err = findNext(result, "any")
+			event, err = findNext(guild, result, "any")
 		}
 	} else {
-		event, err = findNext("any", "any")
+		event, err = findNext(guild, "any", "any")
 	}
 	if err != nil {
-		do.Description = ":warning: No event found."
+		do.Description = tpl.Text("next.not_found", nil)
 		return
 	}
-	// Parse the time of the event, calculate time delta, do some formatting and finally show the results.
+	// Calculate the time delta until the event, do some formatting and finally show the results.
 	// The times are localised as per the user's time zone before being shown.
 	// The time delta between now and the next event uses modulo to perfectly round days, hour an minutes.
-	t, err := time.Parse(timeFormat, event[3])
-	if err != nil {
-		do.Description = ":warning: Error parsing time."
-		log.Println("cmdNext:", err)
-		return
-	}
+	t := event.Time
 	delta := time.Until(t)
 	loc, err := time.LoadLocation(tz)
 	if err != nil {
-		do.Description = ":warning: Error converting time to user time zone. Using default one."
+		do.Description = tpl.Text("next.error_timezone", nil)
 		log.Println("cmdNext:", err)
 		return
 	}
 	t = t.In(loc)
-	wday := t.Weekday().String()
-	mday := t.Day()
-	month := t.Month()
-	hour := t.Hour()
-	min := t.Minute()
 	zone, offset := t.Zone()
-	uoffset := offset / 3600
 	delta = delta / 1000000000
-	days := int((delta % (86400 * 30)) / 86400)
-	hours := int((delta % 86400) / 3600)
-	minutes := int((delta % 3600) / 60)
+	data := vars{
+		"Event":   event,
+		"Time":    t,
+		"Zone":    zone,
+		"Offset":  offset / 3600,
+		"Days":    int((delta % (86400 * 30)) / 86400),
+		"Hours":   int((delta % 86400) / 3600),
+		"Minutes": int((delta % 3600) / 60),
+	}
 	fields := []map[string]string{}
 	date := map[string]string{
-		"Name":  "Date:",
-		"Value": fmt.Sprintf("%s, %d %s", wday, mday, month),
+		"Name":  tpl.Text("next.date", nil),
+		"Value": tpl.Text("next.date_value", data),
 	}
 	schedule := map[string]string{
-		"Name":  "Time:",
-		"Value": fmt.Sprintf("%02d:%02d %s (UTC+%d)", hour, min, zone, uoffset),
+		"Name":  tpl.Text("next.time", nil),
+		"Value": tpl.Text("next.time_value", data),
 	}
 	category := map[string]string{
-		"Name":  "Category:",
-		"Value": event[0],
+		"Name":  tpl.Text("event.category", nil),
+		"Value": event.Category,
 	}
 	description := map[string]string{
-		"Name":  "Event:",
-		"Value": fmt.Sprintf("%s %s", event[1], event[2]),
+		"Name":  tpl.Text("event.event", nil),
+		"Value": tpl.Text("event.event_value", data),
 	}
 	countdown := map[string]string{
-		"Name":  "Countdown:",
-		"Value": fmt.Sprintf("%d day(s), %d hour(s), %d minute(s)", days, hours, minutes),
+		"Name":  tpl.Text("next.countdown", nil),
+		"Value": tpl.Text("next.countdown_value", data),
 	}
 	fields = append(fields, date, schedule, category, description, countdown)
-	if event[5] != "" {
-		image = event[5]
+	if event.Image != "" {
+		image = event.Image
 	}
-	do.Color = 0x3f82ef
+	do.Color = colorInfo
 	do.Fields = &fields
 	do.Image = &image
 	return
@@ -822,87 +1605,63 @@ func cmdNext(dg *discordgo.Session, channel string, user string, search string)
 
 // The ping command receives a Discord session pointer, a channel, a user and an arguments slice of strings.
 // It then answers to the user using the Pong word or the target word passed by the user as an argument.
-func cmdPing(dg *discordgo.Session, channel string, user string, args []string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "PING", "")
-	users, err := readCSV(usersFile)
+func cmdPing(dg *discordgo.Session, guild string, channel string, user string, args []string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("ping.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdQuote:", err)
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdPing:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
-	do.Color = 0x3f82ef
+	do.Embeds = embeds
+	do.Color = colorInfo
 	// Distinguish between sending simply the word Pong or whatver word was passed as argument by the user.
 	if len(args) > 0 {
 		do.Description = args[0]
 	} else {
-		do.Description = "Pong."
+		do.Description = tpl.Text("ping.pong", nil)
 	}
 	return
 }
 
 // The plugin command receives a name, a Discord session pointer, a channel, a user and an arguments slice of strings.
 // It then tries to execute the given plugin name if a file with that name is found on the plugins folder.
-func cmdPlugin(name string, dg *discordgo.Session, channel string, user string, args []string, finishedCh chan bool) {
+func cmdPlugin(name string, dg *discordgo.Session, guild string, channel string, user string, args []string) (do *DiscordOutput) {
 	var cmd *exec.Cmd
-	do := NewDiscordOutput(dg, 0xb40000, strings.ToUpper(name), "")
-	users, err := readCSV(usersFile)
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, strings.ToUpper(name), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
-		do.Send(channel)
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdPlugin:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
+	do.Embeds = embeds
 	// We check if the command is a plugin or not by checking if a file with that name exists.
 	// If it doesn't exist this isn't a valid plugin and therefore we must stop the execution.
-	if !fileExists(pluginsFolder + name) {
-		select {
-		case finishedCh <- true:
-			// The plugin doesn't exist, but we still send true to the finished channel.
-		case <-time.After(1 * time.Second):
-			// If the main thread doesn't read the channel, then timeout after 1 second.
-		}
-		do.Description = ":warning: Unkown command or plugin."
-		do.Send(channel)
+	if _, ok := commandName(name); !ok {
+		do.Description = tpl.Text("plugin.unknown", nil)
 		return
 	}
 	// Otherwise this is a valid plugin and we execute the process with the correct arguments.
 	if len(args) == 0 {
-		cmd = exec.Command(pluginsFolder+name, user)
+		cmd = exec.Command(cfg().Files.Plugins+name, user)
 	} else {
 		var fullArgs []string
 		fullArgs = append(fullArgs, user)
 		fullArgs = append(fullArgs, args...)
-		cmd = exec.Command(pluginsFolder+name, fullArgs...)
+		cmd = exec.Command(cfg().Files.Plugins+name, fullArgs...)
 	}
 	cmdOutput, err := cmd.CombinedOutput()
 	if err != nil {
-		select {
-		case finishedCh <- true:
-			// The plugin had a problem, but we still send true to the finished channel.
-		case <-time.After(1 * time.Second):
-			// If the main thread doesn't read the channel, then timeout after 1 second.
-		}
-		do.Description = ":warning: Error executing plugin."
-		do.Send(channel)
+		do.Description = tpl.Text("plugin.error", nil)
 		log.Println("cmdPlugin:", err)
 		return
 	}
-	do.Color = 0x3f82ef
+	do.Color = colorInfo
 	do.Description = string(cmdOutput)
+	do.Paginate = true
 	split := strings.Split(string(cmdOutput), "\n")
 	if len(split) > 0 {
 		if strings.HasPrefix(split[0], "GLUCORD-PLUGIN-HEADER:") {
@@ -912,241 +1671,256 @@ func cmdPlugin(name string, dg *discordgo.Session, channel string, user string,
 			}
 		}
 	}
-	select {
-	case finishedCh <- true:
-		// The plugin finished with success so we send true to the finished channel.
-	case <-time.After(1 * time.Second):
-		// If the main thread doesn't read the channel, then timeout after 1 second.
-	}
-	do.Send(channel)
+	return
 }
 
-// The poll command receives a Discord session pointer, a channel, a user and an arguments slice of strings.
+// The poll command receives a Discord session pointer, a channel, a user, an arguments slice of strings and a duration.
 // It then makes a poll on a Discord channel using the poll question and all the possible answer options.
-// It then waits for votes from the users and finally displays the results of the poll after a timeout.
-func cmdPoll(dg *discordgo.Session, channel string, user string, args []string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "POLL (5 min)", "")
-	users, err := readCSV(usersFile)
+// It then waits for votes from the users and finally displays the results of the poll after the duration.
+func cmdPoll(dg *discordgo.Session, guild string, channel string, user string, args []string, duration time.Duration) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("poll.title", vars{"Minutes": int(duration.Minutes())}), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
-		do.Send(channel)
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdPoll:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
+	do.Embeds = embeds
 	optionsUnicode := []string{"🇦", "🇧", "🇨", "🇩", "🇪", "🇫"}
+	if len(args) < 3 || len(args) > len(optionsUnicode)+1 {
+		do.Description = tpl.Text("poll.usage", vars{"Prefix": cfg().guild(guild).Prefix})
+		return
+	}
+	if duration < time.Minute || duration > 24*time.Hour {
+		do.Description = tpl.Text("poll.duration", nil)
+		return
+	}
 	optionsValue := ""
+	var buttons []discordgo.MessageComponent
 	for i := 1; i != len(args); i++ {
 		optionsValue += fmt.Sprintf("%s - %s\n", optionsUnicode[i-1], args[i])
+		buttons = append(buttons, discordgo.Button{
+			Label:    truncate(args[i], 80),
+			Emoji:    discordgo.ComponentEmoji{Name: optionsUnicode[i-1]},
+			Style:    discordgo.PrimaryButton,
+			CustomID: "vote:" + strconv.Itoa(i-1),
+		})
 	}
 	fields := []map[string]string{}
 	question := map[string]string{
-		"Name":  "Question:",
+		"Name":  tpl.Text("poll.question", nil),
 		"Value": args[0],
 	}
 	options := map[string]string{
-		"Name":  "Answers:",
+		"Name":  tpl.Text("poll.answers", nil),
 		"Value": optionsValue,
 	}
 	fields = append(fields, question, options)
 	do.Fields = &fields
-	do.Color = 0x3f82ef
+	do.Color = colorInfo
+	// Users vote with the buttons below the poll, one per option, which can be on two rows of up to 5 buttons.
+	for len(buttons) > 0 {
+		n := len(buttons)
+		if n > 5 {
+			n = 5
+		}
+		do.Components = append(do.Components, discordgo.ActionsRow{Components: buttons[:n]})
+		buttons = buttons[n:]
+	}
+	// Once the poll is sent, its votes are kept in memory until the duration is over.
+	// Then the buttons are removed and the results are shown.
+	do.OnSend = func(m *discordgo.Message) {
+		pollsMu.Lock()
+		polls[m.ID] = &poll{options: args[1:], votes: make(map[string]int)}
+		pollsMu.Unlock()
+		go func() {
+			time.Sleep(duration)
+			pollsMu.Lock()
+			p := polls[m.ID]
+			delete(polls, m.ID)
+			pollsMu.Unlock()
+			results := make(map[string]int)
+			for _, option := range p.votes {
+				results[fmt.Sprintf("%s - %s", optionsUnicode[option], args[option+1])]++
+			}
+			scoreList := make(ScoreList, 0, len(results))
+			for k, v := range results {
+				scoreList = append(scoreList, Score{k, v})
+			}
+			sort.Sort(sort.Reverse(scoreList))
+			dg.ChannelMessageSend(m.ChannelID, tpl.Text("poll.results", vars{"Results": scoreList}))
+			edit := discordgo.NewMessageEdit(m.ChannelID, m.ID)
+			edit.Components = []discordgo.MessageComponent{}
+			edit.Embeds = m.Embeds
+			_, err := dg.ChannelMessageEditComplex(edit)
+			if err != nil {
+				log.Println("cmdPoll:", err)
+			}
+		}()
+	}
 	return
 }
 
-// The processbets command receives a Discord session pointer, a channel and a nick.
-// It then processes the placed bets, according to the results in the results file.
-func cmdProcessBets(dg *discordgo.Session, channel string, user string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "PROCESSBETS", "")
-	users, err := readCSV(usersFile)
-	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdHelp:", err)
-		return
-	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
-	if strings.ToLower(user) != strings.ToLower("541209780929167400") {
-		do.Description = ":warning: Only gluon can use this command."
-		return
-	}
-	users, err = readCSV(betFile)
-	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdProcessBets:", err)
-		return
-	}
-	results, err := readCSV(resultsFile)
-	if err != nil {
-		do.Description = ":warning: Error getting results."
-		log.Println("cmdProcessBets:", err)
-		return
-	}
-	if results[0][0] == results[0][4] {
-		do.Description = ":warning: " + results[0][0] + " bets have already been processed in the past."
-		return
-	}
-	bets, err := readCSV(betsFile)
-	if err != nil {
-		do.Description = ":warning: Error getting bets."
-		log.Println("cmdProcessBets:", err)
-		return
-	}
-	users, err = readCSV(betFile)
-	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdProcessBets:", err)
-		return
+// Type that represents a poll that is still open, with the option each user voted for.
+type poll struct {
+	options []string
+	votes   map[string]int
+}
+
+var (
+	pollsMu sync.Mutex               // Protects polls.
+	polls   = make(map[string]*poll) // Open polls, by the ID of their message.
+)
+
+// The componentVote function handles the buttons of a poll, recording the vote of whoever clicked one of them.
+// Each user has a single vote, so voting again changes it.
+func componentVote(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	option, err := strconv.Atoi(field(args, 0))
+	user := interactionUser(i)
+	tpl := userTemplates(i.GuildID, user)
+	pollsMu.Lock()
+	p, ok := polls[i.Message.ID]
+	if ok && err == nil && option >= 0 && option < len(p.options) {
+		p.votes[user] = option
+	}
+	pollsMu.Unlock()
+	switch {
+	case !ok:
+		respondText(s, i, tpl.Text("poll.closed", nil))
+	case err != nil || option < 0 || option >= len(p.options):
+		respondText(s, i, tpl.Text("poll.invalid_option", nil))
+	default:
+		respondText(s, i, tpl.Text("poll.voted", vars{"Option": p.options[option]}))
 	}
-	drivers, err := readCSV(driversFile)
+}
+
+// The processbets command receives a Discord session pointer, a guild, a channel and a nick.
+// It then processes the placed bets of the guild, according to the results in its results file.
+func cmdProcessBets(dg *discordgo.Session, guild string, channel string, user string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("processbets.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting drivers."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdProcessBets:", err)
 		return
 	}
-	odds, err := toStringMap(drivers, 1, 2)
+	do.Embeds = embeds
+	st := store.Guild(guild)
+	drivers, err := store.Drivers()
 	if err != nil {
-		do.Description = ":warning: Error getting odds."
+		do.Description = tpl.Text("error.drivers", nil)
 		log.Println("cmdProcessBets:", err)
 		return
 	}
-	// This is the main loop where we go through each bet placed by the user and process it.
-	// If the race on the bet matches the race on the results file, we calculate its score.
-	for i, bet := range bets {
-		score := 0
-		first := strings.ToLower(results[0][1])
-		second := strings.ToLower(results[0][2])
-		third := strings.ToLower(results[0][3])
-		if strings.ToLower(bet[0]) == strings.ToLower(results[0][0]) {
-			// If the first driver is on the podium, we have two different possibilities.
-			// If the first driver is the first on the results, we score 10 * multiplier.
-			// If the first driver is not the first on the results, we score 5 * multiplier.
-			if contains([]string{first, second, third}, strings.ToLower(bet[2])) {
-				multiplier, err := strconv.Atoi(odds[bet[2]])
-				if err != nil {
-					do.Description = ":warning: Error applying multiplier."
-					log.Println("cmdProcessBets:", err)
-					return
-				}
-				if strings.ToLower(bet[2]) == strings.ToLower(results[0][1]) {
-					score += (10 * multiplier)
-				} else {
-					score += (5 * multiplier)
-				}
-			}
-			// If the second driver is on the podium, we have two different possibilities.
-			// If the second driver is the second on the results, we score 10 * multiplier.
-			// If the second driver is not the second on the results, we score 5 * multiplier.
-			if contains([]string{first, second, third}, strings.ToLower(bet[3])) {
-				multiplier, err := strconv.Atoi(odds[bet[3]])
-				if err != nil {
-					do.Description = ":warning: Error applying multiplier."
-					log.Println("cmdProcessBets:", err)
-					return
-				}
-				if strings.ToLower(bet[3]) == strings.ToLower(results[0][2]) {
-					score += (10 * multiplier)
-				} else {
-					score += (5 * multiplier)
-				}
-			}
-			// If the third driver is on the podium, we have two different possibilities.
-			// If the third driver is the third on the results, we score 10 * multiplier.
-			// If the third driver is not the third on the results, we score 5 * multiplier.
-			if contains([]string{first, second, third}, strings.ToLower(bet[4])) {
-				multiplier, err := strconv.Atoi(odds[bet[4]])
-				if err != nil {
-					do.Description = ":warning: Error applying multiplier."
-					log.Println("cmdProcessBets:", err)
-					return
-				}
-				if strings.ToLower(bet[4]) == strings.ToLower(results[0][3]) {
-					score += (10 * multiplier)
-				} else {
-					score += (5 * multiplier)
+	odds := make(map[string]int)
+	for _, d := range drivers {
+		odds[strings.ToLower(d.Code)] = d.Odds
+	}
+	// The whole processing happens while updating the results file, so that two concurrent calls
+	// can't both see the race as unprocessed and award the points twice. Any early exit returns an
+	// error, which leaves the results file untouched, and sets the description shown to the user.
+	var race string
+	err = st.UpdateResult(func(results Result) (Result, error) {
+		race = results.Race
+		if results.Race == results.Processed {
+			do.Description = tpl.Text("processbets.already", vars{"Race": results.Race})
+			return results, ErrNoChange
+		}
+		// This is the main loop where we go through each bet placed by the user and process it.
+		// If the race on the bet matches the race on the results file, we calculate its score.
+		// Each driver on the podium scores 10 * multiplier if the position was right, 5 * multiplier otherwise.
+		scores := make(map[string]int)
+		podium := []string{strings.ToLower(results.Podium[0]), strings.ToLower(results.Podium[1]), strings.ToLower(results.Podium[2])}
+		err := st.UpdateBets(func(bets []Bet) ([]Bet, error) {
+			for i, bet := range bets {
+				score := 0
+				if !strings.EqualFold(bet.Race, results.Race) {
+					continue
 				}
-			}
-			bets[i][5] = strconv.Itoa(score)
-			// Update the total number of points for each driver on the users file.
-			// The code above only handles points for each bet, not for each user.
-			for j, user := range users {
-				if strings.ToLower(user[0]) == strings.ToLower(bet[1]) {
-					currentScore, err := strconv.Atoi(users[j][2])
-					if err != nil {
-						do.Description = ":warning: Error getting current score."
-						log.Println("cmdProcessBets:", err)
-						return
+				for position, driver := range bet.Drivers {
+					driver = strings.ToLower(driver)
+					if !contains(podium, driver) {
+						continue
+					}
+					multiplier, ok := odds[driver]
+					if !ok {
+						do.Description = tpl.Text("processbets.error_multiplier", nil)
+						return nil, errors.New("no odds for driver " + driver)
+					}
+					if driver == podium[position] {
+						score += (10 * multiplier)
+					} else {
+						score += (5 * multiplier)
 					}
-					users[j][2] = strconv.Itoa(currentScore + score)
 				}
+				bets[i].Points = score
+				scores[strings.ToLower(bet.User)] += score
 			}
+			return bets, nil
+		})
+		if err != nil {
+			if do.Description == "" {
+				do.Description = tpl.Text("processbets.error_bets", nil)
+			}
+			return results, err
 		}
-		err = writeCSV(betFile, users)
+		// Update the total number of points for each driver on the bet file.
+		// The code above only handles points for each bet, not for each user.
+		err = st.UpdateBettors(func(bettors []Bettor) ([]Bettor, error) {
+			for j, bettor := range bettors {
+				bettors[j].Points += scores[strings.ToLower(bettor.ID)]
+			}
+			return bettors, nil
+		})
 		if err != nil {
-			do.Description = ":warning: Error storing user points."
-			log.Println("cmdProcessBets:", err)
-			return
+			do.Description = tpl.Text("processbets.error_bettors", nil)
+			return results, err
 		}
-	}
-	// Finally update the bets file with the points for each bet for the current race.
-	// The results file is updated so that the last field is set to the current race.
-	err = writeCSV(betsFile, bets)
+		// Finally the results file is updated so that the last field is set to the current race.
+		results.Processed = results.Race
+		return results, nil
+	})
 	if err != nil {
-		do.Description = ":warning: Error storing bet points."
+		if do.Description == "" {
+			do.Description = tpl.Text("processbets.error_results", nil)
+		}
 		log.Println("cmdProcessBets:", err)
 		return
 	}
-	results[0][4] = results[0][0]
-	err = writeCSV(resultsFile, results)
-	if err != nil {
-		do.Description = ":warning: Error storing last processed bet.."
-		log.Println("cmdProcessBets:", err)
+	if do.Description != "" {
 		return
 	}
-	do.Color = 0x3f82ef
-	do.Description = results[0][0] + " bets successfully processed."
+	do.Color = colorInfo
+	do.Description = tpl.Text("processbets.done", vars{"Race": race})
 	return
 }
 
-// The quote command receives a Discord session pointer, a channel and an arguments slice of strings.
+// The quote command receives a Discord session pointer, a guild, a channel and an arguments slice of strings.
 // It then checks if there are arguments and displays a random quote or adds a new quote accordingly.
-func cmdQuote(dg *discordgo.Session, channel string, user string, args []string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "QUOTE", "")
-	users, err := readCSV(usersFile)
+func cmdQuote(dg *discordgo.Session, guild string, channel string, user string, args []string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("quote.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdQuote:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
-	}
+	do.Embeds = embeds
 	// Get a collection of quotes stored as a CSV file.
-	quotes, err := readCSV(quotesFile)
+	st := store.Guild(guild)
+	quotes, err := st.Quotes()
 	if err != nil {
-		do.Description = ":warning: Error getting quote."
+		do.Description = tpl.Text("quote.error", nil)
 		log.Println("cmdQuote:", err)
 		return
 	}
 	// Filter only the quotes of the current channel.
-	var channelQuotes [][]string
+	var channelQuotes []Quote
 	for _, quote := range quotes {
-		if strings.EqualFold(quote[2], channel) {
+		if strings.EqualFold(quote.Channel, channel) {
 			channelQuotes = append(channelQuotes, quote)
 		}
 	}
@@ -1156,286 +1930,413 @@ func cmdQuote(dg *discordgo.Session, channel string, user string, args []string)
 	// Finally we show a random quote on the channel.
 	if len(args) == 0 || (len(args) > 0 && strings.ToLower(args[0]) == "get") {
 		if len(channelQuotes) == 0 {
-			do.Description = ":warning: There are no quotes for this channel."
+			do.Description = tpl.Text("quote.none", nil)
 			return
 		}
 		rand.Seed(time.Now().UnixNano())
 		index := rand.Intn(len(channelQuotes))
-		do.Color = 0x3f82ef
-		do.Description = fmt.Sprintf("%s - %s", channelQuotes[index][1], channelQuotes[index][0])
+		do.Color = colorInfo
+		do.Description = tpl.Text("quote.quote", vars{"Quote": channelQuotes[index]})
 		// If there is more than one argument and the first argument is "add", add the provided quote.
 		// Finally we show a confirmation message on the channel.
 	} else if len(args) > 1 && strings.ToLower(args[0]) == "add" {
-		quotes = append(quotes, []string{time.Now().Format("02-01-2006"), strings.Join(args[1:], " "), strings.ToLower(channel)})
-		err = writeCSV(quotesFile, quotes)
+		quote := Quote{Date: time.Now().Format("02-01-2006"), Text: strings.Join(args[1:], " "), Channel: strings.ToLower(channel)}
+		err = st.UpdateQuotes(func(quotes []Quote) ([]Quote, error) {
+			return append(quotes, quote), nil
+		})
 		if err != nil {
-			do.Description = "Error adding quote."
+			do.Description = tpl.Text("quote.error_adding", nil)
 			log.Println("cmdQuote:", err)
 			return
 		}
-		do.Color = 0x3f82ef
-		do.Description = "Quote added."
+		do.Color = colorInfo
+		do.Description = tpl.Text("quote.added", nil)
 		// Otherwise, if we get here, it means the user didn't use the command correctly.
 		// Ttherefore we show a usage message on the channel.
 	} else {
-		do.Description = "Usage: !quote [get|add] [text]"
+		do.Description = tpl.Text("quote.usage", vars{"Prefix": cfg().guild(guild).Prefix})
 	}
 	return
 }
 
-// The register command receives a Discord session pointer, a channel and a user.
-// It then checks if the user isn't already registered and registers it with the bot.
-func cmdRegister(dg *discordgo.Session, channel string, user string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "REGISTER", "")
-	users, err := readCSV(usersFile)
+// The reload command receives a Discord session pointer, a channel and a user.
+// It then reloads the configuration of the bot and shows what changed.
+func cmdReload(dg *discordgo.Session, guild string, channel string, user string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("reload.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdRegister:", err)
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdReload:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
+	do.Embeds = embeds
+	changes, err := reloadConfig(dg)
+	if err != nil {
+		do.Description = tpl.Text("reload.error", vars{"Error": err})
+		log.Println("cmdReload:", err)
+		return
+	}
+	do.Color = colorInfo
+	if len(changes) == 0 {
+		do.Description = tpl.Text("reload.unchanged", nil)
+		return
 	}
+	do.Description = tpl.Text("reload.done", vars{"Changes": changes})
+	return
+}
+
+// The register command receives a Discord session pointer, a channel and a user.
+// It then checks if the user isn't already registered and registers it with the bot.
+func cmdRegister(dg *discordgo.Session, guild string, channel string, user string) (do *DiscordOutput) {
+	var err error
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("register.title", nil), "")
 	// If the user is already a known user to the bot, we don't register it.
 	// Otherwise we add this new user as a registered user on the users file.
-	if isUser(strings.ToLower(user), users) {
-		do.Description = ":warning: You are already registered."
+	registered := false
+	err = store.UpdateUsers(func(users []User) ([]User, error) {
+		for _, u := range users {
+			if strings.EqualFold(u.ID, user) {
+				do.Embeds = u.Embeds
+				registered = true
+				return nil, ErrNoChange
+			}
+		}
+		u := newUser(user)
+		u.Embeds = true
+		return append(users, u), nil
+	})
+	if registered {
+		do.Description = tpl.Text("register.already", nil)
 		return
 	}
-	users = append(users, []string{strings.ToLower(user), "Europe/Berlin", "embeds", ""})
-	err = writeCSV(usersFile, users)
 	if err != nil {
-		do.Description = ":warning: Error registering user."
+		do.Description = tpl.Text("register.error", nil)
 		log.Println("cmdRegister:", err)
 		return
 	}
-	do.Color = 0x3f82ef
-	do.Description = "You have successfully registered."
+	do.Color = colorInfo
+	do.Description = tpl.Text("register.done", nil)
 	return
 }
 
-// The roles command receives a Discord session pointer, a channel, a user and an arguments slice of strings.
+// The roles command receives a Discord session pointer, a guild, a channel, a user and an arguments slice of strings.
 // It then shows a list of added and available roles or allows the user to add or remove roles on the server.
-func cmdRoles(dg *discordgo.Session, channel string, user string, args []string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "ROLES", "")
-	users, err := readCSV(usersFile)
+// The list comes with a select menu, so that users can also add or remove roles by picking them (see componentRoles).
+func cmdRoles(dg *discordgo.Session, guild string, channel string, user string, args []string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("roles.title", nil), "")
+	embeds, err := embedsEnabled(user)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdRoles:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
+	do.Embeds = embeds
+	if guild == "" {
+		do.Description = tpl.Text("roles.not_server", nil)
+		return
 	}
-	roles, err := readCSV(rolesFile)
+	roles, err := store.Guild(guild).Roles()
 	if err != nil {
-		do.Description = ":warning: Error getting roles."
+		do.Description = tpl.Text("roles.error_roles", nil)
 		log.Println("cmdRoles:", err)
 		return
 	}
 	guildRoles, err := dg.GuildRoles(guild)
 	if err != nil {
-		do.Description = ":warning: Error getting guild roles."
+		do.Description = tpl.Text("roles.error_guild_roles", nil)
 		log.Println("cmdRoles:", err)
 		return
 	}
 	member, err := dg.GuildMember(guild, user)
 	if err != nil {
-		do.Description = ":warning: Error getting guild member."
+		do.Description = tpl.Text("roles.error_member", nil)
 		log.Println("cmdRoles:", err)
 		return
 	}
 	// We have two possibilities, either the user passes no arguments or else, we consider only the first one.
-	// The first branch doesn't have early exits, so we use the return at the end of the function to return the output.
-	// The second branch though has several possible early exists, so we use local returns to return the output.
-	// Except at the very end, where nothing else will run, so we can use the return at the end of the function.
-	if len(args) == 0 {
-		do.Color = 0x3f82ef
-		do.Description += "**Current roles you are added to:**\n\n"
-		for _, v := range member.Roles {
-			for _, w := range guildRoles {
-				if strings.EqualFold(v, w.ID) {
-					do.Description += w.Name + "\n"
-				}
+	if len(args) > 0 {
+		do.Description, err = toggleRole(dg, tpl, guild, member, args[0], roles, guildRoles)
+		if err != nil {
+			log.Println("cmdRoles:", err)
+		}
+		return
+	}
+	do.Color = colorInfo
+	var current, available []string
+	for _, v := range member.Roles {
+		for _, w := range guildRoles {
+			if strings.EqualFold(v, w.ID) {
+				current = append(current, w.Name)
 			}
 		}
-		do.Description += "\n**Available roles that you can add/remove:**\n\n"
-		for _, v := range roles {
-			do.Description += v[0] + "\n"
+	}
+	var choices []discordgo.SelectMenuOption
+	for _, v := range roles {
+		available = append(available, v.Name)
+		// Select menus can't have more than 25 options, the other roles can still be picked by name.
+		if len(choices) < 25 {
+			choices = append(choices, discordgo.SelectMenuOption{Label: truncate(v.Name, 100), Value: v.Name})
 		}
-		do.Description += "\n**To add/remove roles call this command with a role name.**\n\nExample: !roles space_notifications"
-	} else {
-		valid := false
-		for _, v := range roles {
-			if strings.EqualFold(args[0], v[0]) {
-				valid = true
-			}
+	}
+	do.Description = tpl.Text("roles.list", vars{"Current": current, "Available": available, "Prefix": cfg().guild(guild).Prefix})
+	if len(choices) > 0 {
+		minValues := 1
+		do.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						CustomID:    "roles",
+						Placeholder: tpl.Text("roles.menu", nil),
+						MinValues:   &minValues,
+						MaxValues:   len(choices),
+						Options:     choices,
+					},
+				},
+			},
 		}
-		if !valid {
-			do.Description = ":warning: This is not one of the available roles."
-			return
+	}
+	return
+}
+
+// The toggleRole function adds a member of a guild to one of the roles available on the roles file, or removes them
+// from it if they were already added, and returns a message saying what was done.
+func toggleRole(dg *discordgo.Session, tpl *Templates, guild string, member *discordgo.Member, name string, roles []Role, guildRoles []*discordgo.Role) (string, error) {
+	valid := false
+	for _, v := range roles {
+		if strings.EqualFold(name, v.Name) {
+			valid = true
 		}
-		for _, v := range guildRoles {
-			if strings.EqualFold(args[0], v.Name) {
-				for _, w := range member.Roles {
-					if strings.EqualFold(v.ID, w) {
-						// The user is already assigned to this role.
-						err := dg.GuildMemberRoleRemove(guild, user, v.ID)
-						if err != nil {
-							do.Description = ":warning: Error removing role."
-							log.Println("cmdRoles:", err)
-							return
-						}
-						do.Description = fmt.Sprintf("You were successfully removed from the %s role.", v.Name)
-						return
+	}
+	if !valid {
+		return tpl.Text("roles.invalid", nil), nil
+	}
+	for _, v := range guildRoles {
+		if strings.EqualFold(name, v.Name) {
+			for _, w := range member.Roles {
+				if strings.EqualFold(v.ID, w) {
+					// The user is already assigned to this role.
+					err := dg.GuildMemberRoleRemove(guild, member.User.ID, v.ID)
+					if err != nil {
+						return tpl.Text("roles.error_removing", nil), err
 					}
+					return tpl.Text("roles.removed", vars{"Role": v.Name}), nil
 				}
-				// The user is not assigned to this role yet.
-				err := dg.GuildMemberRoleAdd(guild, user, v.ID)
-				if err != nil {
-					do.Description = ":warning: Error adding role."
-					log.Println("cmdRoles:", err)
-					return
-				}
-				do.Description = fmt.Sprintf("You were successfully added to the %s role.", v.Name)
-				return
 			}
+			// The user is not assigned to this role yet.
+			err := dg.GuildMemberRoleAdd(guild, member.User.ID, v.ID)
+			if err != nil {
+				return tpl.Text("roles.error_adding", nil), err
+			}
+			return tpl.Text("roles.added", vars{"Role": v.Name}), nil
+		}
+	}
+	// We only get here, if one of the allowed roles from the CSV file was not found on the server.
+	return tpl.Text("roles.missing", vars{"Role": name}), nil
+}
+
+// The componentRoles function handles the select menu of the roles command.
+// Each role picked is toggled for whoever picked it, who is the only one to see the result.
+func componentRoles(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	tpl := userTemplates(i.GuildID, interactionUser(i))
+	if i.Member == nil {
+		respondText(s, i, tpl.Text("roles.not_server", nil))
+		return
+	}
+	roles, err := store.Guild(i.GuildID).Roles()
+	if err != nil {
+		respondText(s, i, tpl.Text("roles.error_roles", nil))
+		log.Println("componentRoles:", err)
+		return
+	}
+	guildRoles, err := s.GuildRoles(i.GuildID)
+	if err != nil {
+		respondText(s, i, tpl.Text("roles.error_guild_roles", nil))
+		log.Println("componentRoles:", err)
+		return
+	}
+	var messages []string
+	for _, name := range i.MessageComponentData().Values {
+		message, err := toggleRole(s, tpl, i.GuildID, i.Member, name, roles, guildRoles)
+		if err != nil {
+			log.Println("componentRoles:", err)
+		}
+		messages = append(messages, message)
+	}
+	respondText(s, i, strings.Join(messages, "\n"))
+}
+
+// The settings command receives a Discord session pointer, a guild, a channel, a user and the settings to change.
+// It then validates and stores the settings that were given, if any, and shows every setting on the user's profile.
+func cmdSettings(dg *discordgo.Session, guild string, channel string, user string, changes map[string]interface{}) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("settings.title", nil), "")
+	u, err := profile(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdSettings:", err)
+		return
+	}
+	do.Embeds = u.Embeds
+	timezone, _ := changes["timezone"].(string)
+	if timezone != "" {
+		// The empty and Local zones are accepted by time.LoadLocation, but they aren't the zone of the user.
+		loc, err := time.LoadLocation(timezone)
+		if err != nil || timezone == "Local" {
+			do.Description = tpl.Text("settings.invalid_timezone", vars{"Timezone": timezone})
+			return
+		}
+		timezone = loc.String()
+	}
+	lang, _ := changes["language"].(string)
+	lang = strings.ToLower(lang)
+	if available := languages(cfg()); lang != "" && !contains(available, lang) {
+		do.Description = tpl.Text("language.unknown", vars{"Language": lang, "Available": available})
+		return
+	}
+	if len(changes) > 0 {
+		err = updateProfile(user, func(p *User) {
+			if timezone != "" {
+				p.Timezone = timezone
+			}
+			if embeds, ok := changes["embeds"].(bool); ok {
+				p.Embeds = embeds
+			}
+			if lang != "" {
+				p.Language = lang
+			}
+			if units, _ := changes["units"].(string); units != "" {
+				p.Units = units
+			}
+			if location, _ := changes["location"].(string); location != "" {
+				p.Location = location
+			}
+			u = *p
+		})
+		if err != nil {
+			do.Description = tpl.Text("settings.error", nil)
+			log.Println("cmdSettings:", err)
+			return
 		}
-		// We only get here, if one of the allowed roles from the CSV file was not found on the server.
-		do.Description = fmt.Sprintf("The %s role doesn't exist on the server.", args[0])
 	}
+	// The settings are shown in the language and with the embeds the user may have just picked.
+	tpl = userTemplates(guild, user)
+	do.Title = tpl.Text("settings.title", nil)
+	do.Embeds = u.Embeds
+	do.Color = colorInfo
+	message := "settings.list"
+	if len(changes) > 0 {
+		message = "settings.changed"
+	}
+	do.Description = tpl.Text(message, vars{
+		"User":     u,
+		"Language": language(guild, user),
+		"Prefix":   cfg().guild(guild).Prefix,
+	})
 	return
 }
 
-// The stats command receives a Discord session pointer, a channel, and a user.
-// It then reads some general user stats periodically stored and displays them.
-func cmdStats(dg *discordgo.Session, channel string, user string) {
-	do := NewDiscordOutput(dg, 0xb40000, "STATS", "")
-	stats, err := readCSV(statsFile)
+// The stats command receives a Discord session pointer, a guild, a channel, and a user.
+// It then reads some general user stats of the guild periodically stored and displays them as a chart.
+func cmdStats(dg *discordgo.Session, guild string, channel string, user string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("stats.title", nil), "")
+	embeds, err := embedsEnabled(user)
+	if err != nil {
+		do.Description = tpl.Text("error.users", nil)
+		log.Println("cmdStats:", err)
+		return
+	}
+	do.Embeds = embeds
+	stats, err := store.Guild(guild).Stats()
 	if err != nil {
-		log.Println("tskStats:", err)
+		do.Description = tpl.Text("stats.error", nil)
+		log.Println("cmdStats:", err)
 		return
 	}
 	// Go through all the stats lines and append each one as a chart value.
 	var values []chart.Value
 	for _, v := range stats {
-		valueFloat, _ := strconv.ParseFloat(v[1], 64)
-		member, _ := dg.GuildMember(guild, v[0])
 		label := ""
-		if valueFloat > 40 {
-			label = member.User.Username + " - " + v[1]
+		if v.Messages > 40 {
+			label = fmt.Sprintf("%s - %d", v.User, v.Messages)
+			member, err := dg.GuildMember(guild, v.User)
+			if err == nil {
+				label = fmt.Sprintf("%s - %d", member.User.Username, v.Messages)
+			}
 		}
-		values = append(values, chart.Value{Value: valueFloat, Label: label})
+		values = append(values, chart.Value{Value: float64(v.Messages), Label: label})
 	}
 	pie := chart.PieChart{
-		Title:      "Total Messages",
+		Title:      tpl.Text("stats.chart", nil),
 		TitleStyle: chart.StyleShow(),
 		Width:      700,
 		Height:     800,
 		Values:     values,
 	}
-	f, _ := os.Create("messages.png")
-	pie.Render(chart.PNG, f)
-	f.Close()
-	f, _ = os.Open("messages.png")
-	do.File(channel, "messages.png", f, "**STATS**")
-	f.Close()
-}
-
-// The weather command receives a Discord session pointer, a channel, a user and an arguments slice of strings.
-// It then shows the current weather for a given location on the channel using the OpenWeatherMap API.
-func cmdWeather(dg *discordgo.Session, channel string, user string, args []string) (do *DiscordOutput) {
-	do = NewDiscordOutput(dg, 0xb40000, "WEATHER", "")
-	users, err := readCSV(usersFile)
+	// The chart is rendered in memory and attached to the output, which shows it as its image when using embeds.
+	var buffer bytes.Buffer
+	err = pie.Render(chart.PNG, &buffer)
 	if err != nil {
-		do.Description = ":warning: Error getting users."
-		log.Println("cmdWeather:", err)
+		do.Description = tpl.Text("stats.error_chart", nil)
+		log.Println("cmdStats:", err)
 		return
 	}
-	for _, u := range users {
-		if strings.EqualFold(u[0], user) {
-			if strings.Contains(strings.ToLower(u[2]), "embeds") {
-				do.Embeds = true
-			}
-		}
+	do.Color = colorInfo
+	do.Files = []*discordgo.File{{Name: "messages.png", ContentType: "image/png", Reader: &buffer}}
+	if embeds {
+		image := "attachment://messages.png"
+		do.Image = &image
+	} else {
+		do.Description = "**" + do.Title + "**"
 	}
-	weather, err := readCSV(weatherFile)
+	return
+}
+
+// The weather command receives a Discord session pointer, a channel, a user and an arguments slice of strings.
+// It then shows the current weather for a given location on the channel using the OpenWeatherMap API.
+func cmdWeather(dg *discordgo.Session, guild string, channel string, user string, args []string) (do *DiscordOutput) {
+	tpl := userTemplates(guild, user)
+	do = NewDiscordOutput(dg, colorError, tpl.Text("weather.title", nil), "")
+	u, err := profile(user)
 	if err != nil {
-		do.Description = ":warning: Error getting weather settings."
+		do.Description = tpl.Text("error.users", nil)
 		log.Println("cmdWeather:", err)
 		return
 	}
-	location := ""
-	tempUnits := "C"
+	do.Embeds = u.Embeds
+	location := u.Location
+	tempUnits := strings.ToUpper(u.Units)
 	windUnits := "m/s"
-	// Neither a location nor temperature unit were provided as an argument to the command.
-	// So we must get the location and temperature unit for the user from the weather file.
-	// If a user in the weather file matches user, we get its location and temperature unit.
-	if len(args) == 0 {
-		for _, v := range weather {
-			if strings.EqualFold(v[0], user) {
-				tempUnits = strings.ToUpper(v[1])
-				location = v[2]
-			}
-		}
-		// A temperature unit was provided as an argument to the command, we must update the setting.
-		// However, we must first check if the user already has a location set on the weather file.
-		// If so, we update the user units, otherwise we ask him to get the weather for a location.
-		// This is so that the user gets registered on the weather file before we can set a location.
-	} else if len(args) == 1 && (strings.ToLower(args[0]) == "c" || strings.ToLower(args[0]) == "f") {
-		var unitsUpdated bool
-		for i, v := range weather {
-			// User with a location on the weather database.
-			if strings.EqualFold(v[0], user) {
-				unitsUpdated = true
-				weather[i][1] = strings.ToLower(args[0])
-			}
-		}
-		if !unitsUpdated {
-			do.Description = ":warning: Get the weather for some location before setting the units."
-			return
-		}
-		err = writeCSV(weatherFile, weather)
+	// Without arguments the weather is shown for the location and units on the profile of the user.
+	// A temperature unit as the only argument changes the units on the profile instead.
+	// Any other arguments are a location, which becomes the location on the profile of the user.
+	if len(args) == 1 && (strings.ToLower(args[0]) == "c" || strings.ToLower(args[0]) == "f") {
+		err = updateProfile(user, func(u *User) {
+			u.Units = strings.ToLower(args[0])
+		})
 		if err != nil {
-			do.Description = ":warning: Error storing weather units."
+			do.Description = tpl.Text("weather.error_units", nil)
 			log.Println("cmdWeather:", err)
 			return
 		}
-		do.Description = "Temperature units updated."
+		do.Description = tpl.Text("weather.units", nil)
 		return
-		// If we reach this point, a location was provided as an argument to the command.
-		// If the user already exists, we update his location, otherwise we register him.
-	} else {
-		var newUser bool = true
+	} else if len(args) > 0 {
 		location = strings.Join(args, " ")
-		for i, v := range weather {
-			// User with a location on the weather database.
-			if strings.EqualFold(v[0], user) {
-				newUser = false
-				weather[i][2] = location
-			}
-		}
-		if newUser {
-			// User without a location on the weather database.
-			weather = append(weather, []string{user, "c", location})
-		}
-		err = writeCSV(weatherFile, weather)
+		err = updateProfile(user, func(u *User) {
+			u.Location = location
+		})
 		if err != nil {
-			do.Description = ":warning: Error storing weather location."
+			do.Description = tpl.Text("weather.error_location", nil)
 			log.Println("cmdWeather:", err)
 			return
 		}
 	}
 	if location == "" {
-		do.Description = ":warning: Please provide a location as argument."
+		do.Description = tpl.Text("weather.location", nil)
 		return
 	}
 	if tempUnits == "F" {
@@ -1443,15 +2344,15 @@ func cmdWeather(dg *discordgo.Session, channel string, user string, args []strin
 	}
 	// Finally we get the current weather at a location using the temperature units.
 	// Then we display a nicely formatted and compact weather string on the channel.
-	w, err := owm.NewCurrent(tempUnits, "en", owmAPIKey)
+	w, err := owm.NewCurrent(tempUnits, "en", cfg().OWMAPIKey)
 	if err != nil {
-		do.Description = ":warning: Error fetching weather."
+		do.Description = tpl.Text("weather.error", nil)
 		log.Println("cmdWeather:", err)
 		return
 	}
 	err = w.CurrentByName(location)
-	if err != nil {
-		do.Description = ":warning: Could not fetch weather for that location."
+	if err != nil || len(w.Weather) == 0 {
+		do.Description = tpl.Text("weather.not_found", nil)
 		log.Println("cmdWeather:", err)
 		return
 	}
@@ -1472,17 +2373,13 @@ func cmdWeather(dg *discordgo.Session, channel string, user string, args []strin
 	case strings.Contains(strings.ToLower(w.Weather[0].Description), "fog"):
 		icon = ":fog:"
 	}
-	icon += " " + w.Weather[0].Description
-	do.Color = 0x3f82ef
-	do.Description =
-		fmt.Sprintf("**%s**\n\n%s\n\n:thermometer: %0.1f%s\n:droplet: %d%%\n:arrow_down: %0.1fhPa\n:triangular_flag_on_post: %0.1f%s",
-			w.Name,
-			icon,
-			w.Main.Temp,
-			tempUnits,
-			w.Main.Humidity,
-			w.Main.Pressure,
-			w.Wind.Speed,
-			windUnits)
+	do.Color = colorInfo
+	do.Description = tpl.Text("weather.weather", vars{
+		"Weather":     w,
+		"Icon":        icon,
+		"Description": w.Weather[0].Description,
+		"TempUnits":   tempUnits,
+		"WindUnits":   windUnits,
+	})
 	return
 }
@@ -0,0 +1,515 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Type that represents the configuration of the bot, read from a TOML file like the following one.
+// Every key is optional except token and owm_api_key, missing keys keep the defaults of defaultConfig.
+// At least one guild must be configured, either with the guild key or with a guilds section.
+//
+//	prefix = "!"
+//	token = "..."            # Or set the GLUCORD_TOKEN environment variable.
+//	guild = "123456789012345678"
+//	feed_interval = 300
+//	owm_api_key = "..."      # Or set the GLUCORD_OWM_API_KEY environment variable.
+//	admins = ["541209780929167400"]
+//	language = "en"          # Language of the messages, users can pick their own with the language command.
+//	reminders = ["1h", "5m", "0s"]  # When events are announced, before they start ("0s" when they start).
+//
+//	[calendar]
+//	listen = ":8080"         # Serves the events as a calendar feed at /events.ics, leave empty to not serve it.
+//	url = "https://bot.example.com"  # Public address of the feed, shown by the calendar command.
+//
+//	[categories."[Formula1]"]  # Channel, image and mention of the events of a category imported from calendars.
+//	channel = "665554362570899476"
+//	image = "https://example.com/f1.png"
+//	mention = "<@&1005570005682901133>"
+//	reminders = ["24h", "1h", "5m", "0s"]  # Replaces the reminders above for the events of the category.
+//	length = "2h"            # How long the events of the category last on calendars, 1 hour if not set.
+//
+//	[storage]
+//	backend = "csv"          # Or "sqlite".
+//	database = "glucord.db"
+//
+//	[rate_limit]
+//	messages = 10            # Messages the bot can send in a burst, 0 for no limit.
+//	period = "10s"           # Time it takes to be able to send a whole burst again.
+//
+//	[cooldowns.weather]      # Also works for plugins, with the name of the plugin.
+//	user = "30s"             # Time each user must wait between uses of the command.
+//	channel = "10s"          # Time the command can't be used on a channel after being used there.
+//
+//	[files]
+//	events = "/var/lib/glucord/events.csv"
+//	plugins = "/usr/lib/glucord/plugins/"
+//	templates = "/etc/glucord/templates.tmpl"  # Redefines some of the messages and theme of templates.tmpl.
+//
+//	[guilds.234567890123456789]
+//	prefix = "?"
+//	language = "pt"
+//	data = "/var/lib/glucord/234567890123456789"
+//	events_channel = "345678901234567890"
+//	disabled = ["poll", "quote"]
+//
+//	[guilds.234567890123456789.roles]
+//	quote = ["Moderator", "456789012345678901"]
+//
+//	[guilds.234567890123456789.categories."[MotoGP]"]  # Replaces the categories section on this guild.
+//	channel = "567890123456789012"
+type Config struct {
+	Prefix       string                    `toml:"prefix"`
+	Token        string                    `toml:"token"`
+	Guild        string                    `toml:"guild"`
+	FeedInterval int                       `toml:"feed_interval"`
+	OWMAPIKey    string                    `toml:"owm_api_key"`
+	Admins       []string                  `toml:"admins"`
+	Language     string                    `toml:"language"`
+	Reminders    []time.Duration           `toml:"reminders"`
+	Calendar     CalendarConfig            `toml:"calendar"`
+	Categories   map[string]CategoryConfig `toml:"categories"`
+	Storage      StorageConfig             `toml:"storage"`
+	RateLimit    RateLimitConfig           `toml:"rate_limit"`
+	Cooldowns    map[string]CooldownConfig `toml:"cooldowns"`
+	Files        FilesConfig               `toml:"files"`
+	Guilds       map[string]GuildConfig    `toml:"guilds"`
+}
+
+// Type that represents the settings of a single guild, on its own section of the configuration.
+// The guild set with the guild key keeps using the data files of the files section, like older versions did.
+// Any other guild gets its own copy of the data files that belong to a server (bets, events, feeds, quotes,
+// roles, stats and so on) on its data folder, while user preferences, drivers and aliases are shared.
+// Roles maps the name of a built-in command to the roles (names or IDs) allowed to use it on the guild.
+// Categories replaces the categories section of the configuration on the guild, if it is set.
+type GuildConfig struct {
+	Prefix        string                    `toml:"prefix"`
+	Language      string                    `toml:"language"`
+	Data          string                    `toml:"data"`
+	EventsChannel string                    `toml:"events_channel"`
+	Disabled      []string                  `toml:"disabled"`
+	Roles         map[string][]string       `toml:"roles"`
+	Categories    map[string]CategoryConfig `toml:"categories"`
+}
+
+// Type that represents the channel, image and mention of the events of a category imported from a calendar, by the
+// name of the category, like the Resolver of the EventManager tool, and the reminders and length of its events.
+type CategoryConfig struct {
+	Channel   string          `toml:"channel"`
+	Image     string          `toml:"image"`
+	Mention   string          `toml:"mention"`
+	Reminders []time.Duration `toml:"reminders"`
+	Length    time.Duration   `toml:"length"`
+}
+
+// Type that represents the calendar section of the configuration, which serves the events as a calendar feed.
+type CalendarConfig struct {
+	Listen string `toml:"listen"`
+	URL    string `toml:"url"`
+}
+
+// Type that represents the storage section of the configuration.
+type StorageConfig struct {
+	Backend  string `toml:"backend"`
+	Database string `toml:"database"`
+}
+
+// Type that represents the rate limit section of the configuration, which limits the messages sent by the bot.
+type RateLimitConfig struct {
+	Messages int           `toml:"messages"`
+	Period   time.Duration `toml:"period"`
+}
+
+// Type that represents the cooldowns of a command, which override the ones declared on the registry.
+type CooldownConfig struct {
+	User    time.Duration `toml:"user"`
+	Channel time.Duration `toml:"channel"`
+}
+
+// Type that represents the files section of the configuration, with the full path to each data file.
+type FilesConfig struct {
+	Alias     string `toml:"alias"`
+	Answers   string `toml:"answers"`
+	Bet       string `toml:"bet"`
+	Bets      string `toml:"bets"`
+	Disabled  string `toml:"disabled"`
+	Drivers   string `toml:"drivers"`
+	Events    string `toml:"events"`
+	Feeds     string `toml:"feeds"`
+	Input     string `toml:"input"`
+	Plugins   string `toml:"plugins"`
+	Quotes    string `toml:"quotes"`
+	Reminders string `toml:"reminders"`
+	Results   string `toml:"results"`
+	Roles     string `toml:"roles"`
+	Stats     string `toml:"stats"`
+	Templates string `toml:"templates"`
+	Usage     string `toml:"usage"`
+	Users     string `toml:"users"`
+	Weather   string `toml:"weather"` // Only read to move the weather settings of older versions to the users file.
+}
+
+// Environment variables that override configuration values, mostly so that secrets can be kept out of the file.
+var configEnv = []struct {
+	name  string
+	apply func(c *Config, value string) error
+}{
+	{"GLUCORD_PREFIX", func(c *Config, v string) error { c.Prefix = v; return nil }},
+	{"GLUCORD_TOKEN", func(c *Config, v string) error { c.Token = v; return nil }},
+	{"GLUCORD_GUILD", func(c *Config, v string) error { c.Guild = v; return nil }},
+	{"GLUCORD_FEED_INTERVAL", func(c *Config, v string) (err error) { c.FeedInterval, err = strconv.Atoi(v); return }},
+	{"GLUCORD_OWM_API_KEY", func(c *Config, v string) error { c.OWMAPIKey = v; return nil }},
+	{"GLUCORD_STORAGE_BACKEND", func(c *Config, v string) error { c.Storage.Backend = v; return nil }},
+	{"GLUCORD_DATABASE", func(c *Config, v string) error { c.Storage.Database = v; return nil }},
+}
+
+// The cfg function returns the current configuration of the bot. The returned value must not be modified.
+// Reloading the configuration replaces it as a whole, so callers that need several settings to be consistent
+// with each other should call cfg once and keep the result.
+func cfg() *Config {
+	return conf.Load().(*Config)
+}
+
+// The defaultConfig function returns a configuration with the default values of every setting.
+func defaultConfig() *Config {
+	return &Config{
+		Prefix:       "!",
+		Language:     "en",
+		Reminders:    []time.Duration{5 * time.Minute},
+		FeedInterval: 300,
+		Storage:      StorageConfig{Backend: "csv", Database: databaseFile},
+		RateLimit:    RateLimitConfig{Messages: 10, Period: 10 * time.Second},
+		Files: FilesConfig{
+			Alias:     aliasFile,
+			Answers:   answersFile,
+			Bet:       betFile,
+			Bets:      betsFile,
+			Disabled:  disabledFile,
+			Drivers:   driversFile,
+			Events:    eventsFile,
+			Feeds:     feedsFile,
+			Input:     inputFile,
+			Plugins:   pluginsFolder,
+			Quotes:    quotesFile,
+			Reminders: remindersFile,
+			Results:   resultsFile,
+			Roles:     rolesFile,
+			Stats:     statsFile,
+			Templates: templatesFile,
+			Usage:     usageFile,
+			Users:     usersFile,
+			Weather:   weatherFile,
+		},
+	}
+}
+
+// The loadConfig function reads the configuration file at path, applies the environment overrides and validates it.
+// If the TOML file doesn't exist but the old config.csv does, that one is read instead so old setups keep working.
+// Instead of stopping at the first problem, every problem found is reported on the returned error, one per line.
+func loadConfig(path string) (c *Config, err error) {
+	var problems []string
+	c = defaultConfig()
+	switch {
+	case fileExists(path):
+		md, err := toml.DecodeFile(path, c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, key := range md.Undecoded() {
+			problems = append(problems, fmt.Sprintf("unknown setting %q", key.String()))
+		}
+	case fileExists(legacyConfigFile):
+		err = loadLegacyConfig(legacyConfigFile, c)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("configuration file %s not found", path))
+	}
+	for _, env := range configEnv {
+		if value, ok := os.LookupEnv(env.name); ok {
+			if err := env.apply(c, value); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid value for %s: %q", env.name, value))
+			}
+		}
+	}
+	for id, g := range c.Guilds {
+		if g.Data == "" {
+			g.Data = filepath.Join("guilds", id)
+		}
+		c.Guilds[id] = g
+	}
+	problems = append(problems, c.validate()...)
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	// The plugin path is built by concatenation, so the folder must end with a separator.
+	if !strings.HasSuffix(c.Files.Plugins, "/") {
+		c.Files.Plugins += "/"
+	}
+	return c, nil
+}
+
+// The loadLegacyConfig function reads the single row config.csv file used before the TOML configuration.
+// Its columns are prefix, token, guild, feed interval, OWM API key and optionally storage backend and database.
+// Older versions had no admins setting, so there are none: the admins must be set on the TOML configuration.
+func loadLegacyConfig(path string, c *Config) error {
+	config, err := readCSV(path)
+	if err != nil {
+		return err
+	}
+	if len(config) == 0 {
+		return errors.New(path + " is empty")
+	}
+	row := config[0]
+	if len(row) < 5 {
+		return fmt.Errorf("%s has %d columns, expected at least 5", path, len(row))
+	}
+	c.Prefix = row[0]
+	c.Token = row[1]
+	c.Guild = row[2]
+	c.FeedInterval, err = strconv.Atoi(strings.TrimSpace(row[3]))
+	if err != nil {
+		return fmt.Errorf("invalid feed interval %q on %s", row[3], path)
+	}
+	c.OWMAPIKey = row[4]
+	if field(row, 5) != "" {
+		c.Storage.Backend = row[5]
+	}
+	if field(row, 6) != "" {
+		c.Storage.Database = row[6]
+	}
+	return nil
+}
+
+// The validate method checks every setting and returns a description of each problem found.
+func (c *Config) validate() (problems []string) {
+	if c.Prefix == "" || strings.ContainsAny(c.Prefix, " \t\n") {
+		problems = append(problems, fmt.Sprintf("prefix %q must be non empty and have no spaces", c.Prefix))
+	}
+	if !contains(languages(c), c.Language) {
+		problems = append(problems, fmt.Sprintf("language %q has no templates (available: %s)", c.Language, strings.Join(languages(c), ", ")))
+	}
+	if c.Token == "" {
+		problems = append(problems, "token is not set (set it on the file or on GLUCORD_TOKEN)")
+	}
+	if c.Guild == "" && len(c.Guilds) == 0 {
+		problems = append(problems, "no guild is set (set guild or add a guilds section)")
+	}
+	if _, err := strconv.ParseUint(c.Guild, 10, 64); c.Guild != "" && err != nil {
+		problems = append(problems, fmt.Sprintf("guild %q is not a valid Discord ID", c.Guild))
+	}
+	for _, id := range c.guildIDs() {
+		g, ok := c.Guilds[id]
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			problems = append(problems, fmt.Sprintf("guilds.%s: %q is not a valid Discord ID", id, id))
+		}
+		if strings.ContainsAny(g.Prefix, " \t\n") {
+			problems = append(problems, fmt.Sprintf("guilds.%s.prefix %q must have no spaces", id, g.Prefix))
+		}
+		if g.Language != "" && !contains(languages(c), g.Language) {
+			problems = append(problems, fmt.Sprintf("guilds.%s.language %q has no templates", id, g.Language))
+		}
+		for name := range g.Roles {
+			if spec, ok := lookupCommand(name); !ok || spec.Name != name {
+				problems = append(problems, fmt.Sprintf("guilds.%s.roles: %q is not the name of a built-in command", id, name))
+			}
+		}
+		problems = append(problems, checkCategories("guilds."+id+".categories", g.Categories)...)
+		if id == c.Guild {
+			continue
+		}
+		if info, err := os.Stat(g.Data); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("guilds.%s.data: %s is not a folder", id, g.Data))
+		}
+	}
+	for _, admin := range c.Admins {
+		if _, err := strconv.ParseUint(admin, 10, 64); err != nil {
+			problems = append(problems, fmt.Sprintf("admins: %q is not a valid Discord ID", admin))
+		}
+	}
+	problems = append(problems, checkReminders("reminders", c.Reminders)...)
+	problems = append(problems, checkCategories("categories", c.Categories)...)
+	if c.Calendar.URL != "" && !strings.HasPrefix(c.Calendar.URL, "http://") && !strings.HasPrefix(c.Calendar.URL, "https://") {
+		problems = append(problems, fmt.Sprintf("calendar.url %q must be an http or https URL", c.Calendar.URL))
+	}
+	if c.FeedInterval < 1 {
+		problems = append(problems, fmt.Sprintf("feed_interval %d must be a positive number of seconds", c.FeedInterval))
+	}
+	if c.OWMAPIKey == "" {
+		problems = append(problems, "owm_api_key is not set (set it on the file or on GLUCORD_OWM_API_KEY)")
+	}
+	if c.RateLimit.Messages < 0 {
+		problems = append(problems, fmt.Sprintf("rate_limit.messages %d must not be negative", c.RateLimit.Messages))
+	}
+	if c.RateLimit.Messages > 0 && c.RateLimit.Period <= 0 {
+		problems = append(problems, fmt.Sprintf("rate_limit.period %s must be positive", c.RateLimit.Period))
+	}
+	for _, name := range sortedKeys(c.Cooldowns) {
+		if c.Cooldowns[name].User < 0 || c.Cooldowns[name].Channel < 0 {
+			problems = append(problems, fmt.Sprintf("cooldowns.%s must not be negative", name))
+		}
+	}
+	switch strings.ToLower(c.Storage.Backend) {
+	case "csv":
+	case "sqlite":
+		if c.Storage.Database == "" {
+			problems = append(problems, "storage.database must be set when using the sqlite backend")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend %q must be either csv or sqlite", c.Storage.Backend))
+	}
+	files := map[string]string{
+		"alias":     c.Files.Alias,
+		"answers":   c.Files.Answers,
+		"bet":       c.Files.Bet,
+		"bets":      c.Files.Bets,
+		"disabled":  c.Files.Disabled,
+		"drivers":   c.Files.Drivers,
+		"events":    c.Files.Events,
+		"feeds":     c.Files.Feeds,
+		"input":     c.Files.Input,
+		"quotes":    c.Files.Quotes,
+		"reminders": c.Files.Reminders,
+		"results":   c.Files.Results,
+		"roles":     c.Files.Roles,
+		"stats":     c.Files.Stats,
+		"usage":     c.Files.Usage,
+		"users":     c.Files.Users,
+		"weather":   c.Files.Weather,
+	}
+	for _, name := range sortedKeys(files) {
+		path := files[name]
+		if path == "" {
+			problems = append(problems, fmt.Sprintf("files.%s must not be empty", name))
+			continue
+		}
+		if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("files.%s: folder of %s does not exist", name, path))
+		}
+	}
+	if info, err := os.Stat(c.Files.Plugins); err != nil || !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("files.plugins: %s is not a folder", c.Files.Plugins))
+	}
+	return
+}
+
+// The checkCategories function checks the categories of a section of the configuration like the events file would.
+func checkCategories(section string, categories map[string]CategoryConfig) (problems []string) {
+	for _, name := range sortedKeys(categories) {
+		c := categories[name]
+		e := Event{Category: name, Name: "-", Session: "-", Time: time.Now(), Channel: c.Channel, Image: c.Image, Mention: c.Mention}
+		if err := checkEvent(e); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: %s", section, name, err))
+		}
+		problems = append(problems, checkReminders(section+"."+name+".reminders", c.Reminders)...)
+		if c.Length < 0 {
+			problems = append(problems, fmt.Sprintf("%s.%s.length: %s must not be negative", section, name, c.Length))
+		}
+	}
+	return
+}
+
+// The checkReminders function checks that the reminders of a section of the configuration aren't after the start.
+func checkReminders(section string, reminders []time.Duration) (problems []string) {
+	for _, before := range reminders {
+		if before < 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s must not be negative", section, before))
+		}
+	}
+	return
+}
+
+// The guildIDs method returns the IDs of all the configured guilds, sorted, starting with the one set on guild.
+func (c *Config) guildIDs() (ids []string) {
+	for id := range c.Guilds {
+		if id != c.Guild {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if c.Guild != "" {
+		ids = append([]string{c.Guild}, ids...)
+	}
+	return
+}
+
+// The guild method returns the settings of a guild, with the global ones filled in for anything not set.
+// Guilds without a section of their own, including direct messages (empty ID), get the global settings.
+func (c *Config) guild(id string) GuildConfig {
+	g := c.Guilds[id]
+	if g.Prefix == "" {
+		g.Prefix = c.Prefix
+	}
+	if g.Language == "" {
+		g.Language = c.Language
+	}
+	if g.Categories == nil {
+		g.Categories = c.Categories
+	}
+	return g
+}
+
+// The partition method returns which copy of the server data files a guild uses: its own ID if it has its own
+// data folder, or an empty string for the data files of the files section (see GuildConfig).
+func (c *Config) partition(id string) string {
+	if _, ok := c.Guilds[id]; ok && id != c.Guild {
+		return id
+	}
+	return ""
+}
+
+// The partitions method returns every partition of the data, the shared one first and then one per guild.
+func (c *Config) partitions() []string {
+	partitions := []string{""}
+	for _, id := range c.guildIDs() {
+		if p := c.partition(id); p != "" {
+			partitions = append(partitions, p)
+		}
+	}
+	return partitions
+}
+
+// The files method returns the paths of the data files used by a partition (see partition).
+// Server data files are placed on the data folder of the guild, keeping the name they have on the files section.
+func (c *Config) files(partition string) FilesConfig {
+	files := c.Files
+	if partition == "" {
+		return files
+	}
+	dir := c.Guilds[partition].Data
+	for _, path := range []*string{&files.Bet, &files.Bets, &files.Disabled, &files.Events, &files.Feeds,
+		&files.Quotes, &files.Reminders, &files.Results, &files.Roles, &files.Stats, &files.Templates} {
+		*path = filepath.Join(dir, filepath.Base(*path))
+	}
+	return files
+}
@@ -0,0 +1,179 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	disabledMu    sync.Mutex                           // Protects disabledCache.
+	disabledCache = make(map[string][]DisabledCommand) // Contents of each disabled file, by path.
+)
+
+// The disabled files are checked for every command, so their contents are kept in memory.
+// They are read again when they change on disk or when they are changed by the enable and disable commands.
+func init() {
+	onDataChange(func(path string) {
+		disabledMu.Lock()
+		defer disabledMu.Unlock()
+		delete(disabledCache, path)
+	})
+}
+
+// The disabledCommands function returns the commands disabled on the partition of a guild, from memory if possible.
+func disabledCommands(guild string) ([]DisabledCommand, error) {
+	path := cfg().files(cfg().partition(guild)).Disabled
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	if disabled, ok := disabledCache[path]; ok {
+		return disabled, nil
+	}
+	var disabled []DisabledCommand
+	if fileExists(path) {
+		var err error
+		disabled, err = store.Guild(guild).Disabled()
+		if err != nil {
+			return nil, err
+		}
+	}
+	disabledCache[path] = disabled
+	return disabled, nil
+}
+
+// The updateDisabled function runs an update on the disabled commands of a guild and drops them from memory.
+func updateDisabled(guild string, fn func(disabled []DisabledCommand) ([]DisabledCommand, error)) error {
+	path := cfg().files(cfg().partition(guild)).Disabled
+	err := store.Guild(guild).UpdateDisabled(fn)
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	delete(disabledCache, path)
+	return err
+}
+
+// The channelScope function returns the channel and category a message sent to a channel belongs to.
+// Messages sent to a thread belong to the channel of the thread, so that disabling a channel covers its threads.
+func channelScope(s *discordgo.Session, channel string) (id string, category string) {
+	ch, err := s.State.Channel(channel)
+	if err != nil {
+		ch, err = s.Channel(channel)
+		if err != nil {
+			log.Println("channelScope:", err)
+			return channel, ""
+		}
+	}
+	if ch.IsThread() {
+		return channelScope(s, ch.ParentID)
+	}
+	return ch.ID, ch.ParentID
+}
+
+// The disabledHere function checks if a command is disabled where a user called it and returns a message saying so,
+// or an empty string if it isn't. The command can be given by any of its names (the one typed and its real name).
+// Commands can be disabled on the configuration of the guild or on its disabled file, on a channel, on a category
+// or on the whole server.
+func disabledHere(s *discordgo.Session, guild string, channel string, user string, names ...string) string {
+	matches := func(command string) bool {
+		for _, name := range names {
+			if strings.EqualFold(command, name) {
+				return true
+			}
+		}
+		return false
+	}
+	tpl := userTemplates(guild, user)
+	for _, command := range cfg().guild(guild).Disabled {
+		if matches(command) {
+			return tpl.Text("disabled.server", nil)
+		}
+	}
+	disabled, err := disabledCommands(guild)
+	if err != nil {
+		log.Println("disabledHere:", err)
+		return ""
+	}
+	// The channel is only looked up on Discord when the command is disabled somewhere on the guild.
+	resolved := false
+	var id, category string
+	for _, d := range disabled {
+		if !matches(d.Command) {
+			continue
+		}
+		if d.Scope == "guild" {
+			if d.ID == "" || d.ID == guild {
+				return tpl.Text("disabled.server", nil)
+			}
+			continue
+		}
+		if !resolved {
+			id, category = channelScope(s, channel)
+			resolved = true
+		}
+		switch {
+		case d.Scope == "channel" && d.ID == id:
+			return tpl.Text("disabled.channel", nil)
+		case d.Scope == "category" && category != "" && d.ID == category:
+			return tpl.Text("disabled.category", nil)
+		}
+	}
+	return ""
+}
+
+// The commandName function returns the real name of a built-in command or plugin, or false if there is none.
+func commandName(name string) (string, bool) {
+	if spec, ok := lookupCommand(name); ok {
+		return spec.Name, true
+	}
+	name = strings.ToLower(name)
+	if name == "" || strings.ContainsAny(name, `/\.`) || !fileExists(cfg().Files.Plugins+name) {
+		return "", false
+	}
+	return name, true
+}
+
+// The disabledEntry function returns the entry of the disabled file that disables a command on a scope (channel,
+// category or server) of a guild, taking the channel and the category from the given channel.
+func disabledEntry(s *discordgo.Session, guild string, channel string, command string, scope string) (DisabledCommand, error) {
+	switch scope {
+	case "server":
+		return DisabledCommand{Command: command, Scope: "guild", ID: guild}, nil
+	case "category":
+		_, category := channelScope(s, channel)
+		if category == "" {
+			return DisabledCommand{}, errors.New("the channel isn't on a category")
+		}
+		return DisabledCommand{Command: command, Scope: "category", ID: category}, nil
+	}
+	id, _ := channelScope(s, channel)
+	return DisabledCommand{Command: command, Scope: "channel", ID: id}, nil
+}
+
+// Small utility function that describes where an entry of the disabled file disables its command.
+func describeEntry(tpl *Templates, d DisabledCommand) string {
+	switch d.Scope {
+	case "channel", "category":
+		return tpl.Text("disabled.scope_"+d.Scope, vars{"ID": d.ID})
+	}
+	return tpl.Text("disabled.scope_server", nil)
+}
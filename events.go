@@ -0,0 +1,357 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	eventsMu    sync.Mutex                     // Protects eventsCache.
+	eventsCache = make(map[string]*EventIndex) // Index of the events of each partition (see Config.partition).
+)
+
+// Type that represents the events of a guild sorted by their start, which every event feature looks up instead of
+// the events file, whose rows can be in any order. It must not be modified once built.
+type EventIndex struct {
+	events  []Event
+	version int64 // Version of the store the events were read from (see versionedStore).
+}
+
+// The events are looked up all the time, so their index is kept in memory until they change, either through
+// updateEvents or behind the back of the bot: on the events file on disk or, with the database, by another program.
+// The reminders due may change with them, so tskEvents is woken up too.
+func init() {
+	onDataChange(func(path string) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		for _, partition := range cfg().partitions() {
+			if cfg().files(partition).Events == path {
+				delete(eventsCache, partition)
+				wakeEvents()
+			}
+		}
+	})
+}
+
+// Formats accepted for the start of the events added or edited with the event command, on the time zone of the user.
+var eventInputFormats = []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// The parseEventTime function parses the start of an event typed by a user on the time zone of the user.
+func parseEventTime(text string, loc *time.Location) (t time.Time, err error) {
+	text = strings.TrimSpace(text)
+	for _, format := range eventInputFormats {
+		t, err = time.ParseInLocation(format, text, loc)
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return t, errors.New("expected a date like 2006-01-02 15:04")
+}
+
+// The checkEvent function checks that an event fits the columns of the events file, returning what is wrong with it.
+// The category, name and session are required, while the channel, mention and image can be empty.
+func checkEvent(e Event) error {
+	for _, f := range []struct{ name, value string }{{"category", e.Category}, {"name", e.Name}, {"session", e.Session}} {
+		if strings.TrimSpace(f.value) == "" {
+			return errors.New("missing " + f.name)
+		}
+		if strings.ContainsAny(f.value, "\r\n") {
+			return errors.New("the " + f.name + " must be on a single line")
+		}
+	}
+	if e.Time.IsZero() {
+		return errors.New("missing date")
+	}
+	if e.Channel != "" && !snowflake.MatchString(e.Channel) {
+		return errors.New("the channel must be a channel ID")
+	}
+	if e.Mention != "" && !roleMention.MatchString(e.Mention) {
+		return errors.New("the mention must be a role")
+	}
+	if e.Image != "" {
+		u, err := url.Parse(e.Image)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("the image must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// The guildEvents function returns the index of the events of a guild, from memory if possible. Stores that other
+// programs can change have their version checked, so that the events are read again after such changes.
+func guildEvents(guild string) (*EventIndex, error) {
+	partition := cfg().partition(guild)
+	st := store.Guild(guild)
+	var version int64
+	if vs, ok := st.(versionedStore); ok {
+		var err error
+		version, err = vs.DataVersion()
+		if err != nil {
+			return nil, err
+		}
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if index, ok := eventsCache[partition]; ok && index.version == version {
+		return index, nil
+	}
+	events, err := st.Events()
+	if err != nil {
+		return nil, err
+	}
+	index := indexEvents(cfg().files(partition).Events, events)
+	index.version = version
+	eventsCache[partition] = index
+	return index, nil
+}
+
+// The indexEvents function builds the index of the events of an events file, skipping and logging the events that
+// miss something the lookups need, rather than failing because of them.
+func indexEvents(path string, events []Event) *EventIndex {
+	index := &EventIndex{}
+	for _, e := range events {
+		if strings.TrimSpace(e.Category) == "" || strings.TrimSpace(e.Name) == "" ||
+			strings.TrimSpace(e.Session) == "" || e.Time.IsZero() {
+			log.Printf("indexEvents: %s: skipping %q, it misses its category, name, session or date", path, e.Category+" "+e.Name+" "+e.Session)
+			continue
+		}
+		index.events = append(index.events, e)
+	}
+	sort.SliceStable(index.events, func(i, j int) bool { return index.events[i].Time.Before(index.events[j].Time) })
+	return index
+}
+
+// The position method returns the position on the index of the first event starting at t or later.
+func (ix *EventIndex) position(t time.Time) int {
+	return sort.Search(len(ix.events), func(i int) bool { return !ix.events[i].Time.Before(t) })
+}
+
+// The Between method returns the events starting from one time until another, sorted by their start. A zero from
+// returns the past events too, while a zero to returns every event after from.
+func (ix *EventIndex) Between(from time.Time, to time.Time) []Event {
+	end := len(ix.events)
+	if !to.IsZero() {
+		end = ix.position(to)
+	}
+	start := ix.position(from)
+	if start > end {
+		start = end
+	}
+	return append([]Event(nil), ix.events[start:end]...)
+}
+
+// The Next method returns the soonest event starting at now or later that matches.
+func (ix *EventIndex) Next(now time.Time, match func(e Event) bool) (Event, bool) {
+	for _, e := range ix.events[ix.position(now):] {
+		if match(e) {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// The NextInCategory method returns the soonest event starting at now or later whose category contains category.
+func (ix *EventIndex) NextInCategory(category string, now time.Time) (Event, bool) {
+	return ix.Next(now, func(e Event) bool { return strings.Contains(strings.ToLower(e.Category), strings.ToLower(category)) })
+}
+
+// The NextInSession method returns the soonest event starting at now or later whose session contains session.
+func (ix *EventIndex) NextInSession(session string, now time.Time) (Event, bool) {
+	return ix.Next(now, func(e Event) bool { return strings.Contains(strings.ToLower(e.Session), strings.ToLower(session)) })
+}
+
+// The Event method returns an event from its number, as shown by the list of the event command, which is its
+// position on the index starting at 1.
+func (ix *EventIndex) Event(number string) (Event, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil || n < 1 || n > len(ix.events) {
+		return Event{}, errors.New("no event " + number)
+	}
+	return ix.events[n-1], nil
+}
+
+// The Number method returns the number of the first event starting at t or later, as taken by the Event method.
+func (ix *EventIndex) Number(t time.Time) int {
+	return ix.position(t) + 1
+}
+
+// The updateEvents function runs an update on the events of a guild, keeping the events file sorted by their start
+// for those reading it, then drops their index from memory and wakes tskEvents up to work out the reminders again.
+func updateEvents(guild string, fn func(events []Event) ([]Event, error)) error {
+	partition := cfg().partition(guild)
+	err := store.Guild(guild).UpdateEvents(func(events []Event) ([]Event, error) {
+		events, err := fn(events)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+		return events, nil
+	})
+	eventsMu.Lock()
+	delete(eventsCache, partition)
+	eventsMu.Unlock()
+	if err == nil {
+		wakeEvents()
+	}
+	return err
+}
+
+// How long events last when their category doesn't say (see CategoryConfig), as calendars show them.
+const defaultEventLength = time.Hour
+
+// The eventLength function returns how long the events of a category last on a guild.
+func eventLength(guild string, category string) time.Duration {
+	if c, ok := cfg().guild(guild).Categories[category]; ok && c.Length > 0 {
+		return c.Length
+	}
+	return defaultEventLength
+}
+
+// The categoryDefaults function returns the channel, image and mention of the latest event of a category, which new
+// events of that category use unless they are given others, like the categories of the EventManager tool.
+func categoryDefaults(events []Event, category string) (defaults Event) {
+	for _, e := range events {
+		if strings.EqualFold(e.Category, category) && !e.Time.Before(defaults.Time) {
+			defaults = e
+		}
+	}
+	return
+}
+
+// Small utility function that returns the position of an event on the events of a guild, or -1 if it isn't there.
+func findEvent(events []Event, e Event) int {
+	for i, other := range events {
+		if other.Time.Equal(e.Time) && other.Category == e.Category && other.Name == e.Name && other.Session == e.Session &&
+			other.Channel == e.Channel && other.Image == e.Image && other.Mention == e.Mention {
+			return i
+		}
+	}
+	return -1
+}
+
+// The applyEventChanges function changes the fields of an event typed by a user on the event command, whose date is
+// on the time zone of the user. The channel, mention and image can be removed with none, so that the event is
+// announced on the events channel of the guild, without mentioning anyone or without an image.
+func applyEventChanges(e *Event, changes map[string]interface{}, loc *time.Location) (err error) {
+	for name, value := range changes {
+		text, ok := value.(string)
+		if !ok {
+			return errors.New("the " + name + " must be text")
+		}
+		text = strings.TrimSpace(text)
+		clear := strings.EqualFold(text, "none")
+		switch name {
+		case "category":
+			e.Category = text
+		case "name":
+			e.Name = text
+		case "session":
+			e.Session = text
+		case "date":
+			e.Time, err = parseEventTime(text, loc)
+			if err != nil {
+				return
+			}
+		case "channel":
+			e.Channel = ""
+			if !clear {
+				e.Channel, err = mentionID(text, "a channel", channelMention)
+				if err != nil {
+					return errors.New("the channel must be a channel or none")
+				}
+			}
+		case "mention":
+			e.Mention = ""
+			if !clear {
+				var id string
+				id, err = mentionID(text, "a role", roleMention)
+				if err != nil {
+					return errors.New("the mention must be a role or none")
+				}
+				e.Mention = "<@&" + id + ">"
+			}
+		case "image":
+			if clear {
+				text = ""
+			}
+			e.Image = text
+		}
+	}
+	return checkEvent(*e)
+}
+
+// Small utility function that checks if there is another event with the same category, name, session and start.
+func duplicateEvent(events []Event, e Event, skip int) bool {
+	for i, other := range events {
+		if i != skip && other.Time.Equal(e.Time) && strings.EqualFold(other.Category, e.Category) &&
+			strings.EqualFold(other.Name, e.Name) && strings.EqualFold(other.Session, e.Session) {
+			return true
+		}
+	}
+	return false
+}
+
+// Periods the events command takes, besides a number of days.
+var eventPeriods = []string{"today", "week", "weekend"}
+
+// The eventPeriod function returns when a period of the events command starts and ends, from now on the time zone
+// of the user: the rest of today, the next 7 days, the next weekend (from Friday to Sunday, or the rest of the
+// current one) or the next given number of days. Without a period, it starts now and never ends (a zero end).
+func eventPeriod(period string, now time.Time) (from time.Time, to time.Time, err error) {
+	from = now
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch strings.ToLower(period) {
+	case "":
+	case "today":
+		to = midnight.AddDate(0, 0, 1)
+	case "week":
+		to = now.AddDate(0, 0, 7)
+	case "weekend":
+		// The weekend ends on the next Monday and, from Monday to Thursday, starts on the next Friday.
+		monday := (8 - int(now.Weekday())) % 7
+		if monday == 0 {
+			monday = 7
+		}
+		if monday > 3 {
+			from = midnight.AddDate(0, 0, monday-3)
+		}
+		to = midnight.AddDate(0, 0, monday)
+	default:
+		n, err := strconv.Atoi(period)
+		if err != nil || n < 1 || n > 366 {
+			return from, to, errors.New("expected today, week, weekend or a number of days up to 366")
+		}
+		to = now.AddDate(0, 0, n)
+	}
+	return
+}
+
+// Small utility function that checks if an argument of the events command is a period rather than a category.
+func isEventPeriod(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil || contains(eventPeriods, strings.ToLower(arg))
+}
@@ -0,0 +1,264 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Small utility function that returns the names of some events, to compare them on the tests.
+func eventNames(events []Event) (names []string) {
+	for _, e := range events {
+		names = append(names, e.Name)
+	}
+	return
+}
+
+// Events of the tests, out of order and with a few that can't be indexed, as on an events file edited by hand.
+func testIndex() (*EventIndex, time.Time) {
+	base := time.Date(2030, 5, 1, 10, 0, 0, 0, time.UTC)
+	return indexEvents("events.csv", []Event{
+		{Category: "[Formula 1]", Name: "Late", Session: "Race", Time: base.Add(48 * time.Hour)},
+		{Category: "[Formula 1]", Name: "Early", Session: "Qualifying", Time: base},
+		{Category: "[MotoGP]", Name: "Mid", Session: "Race", Time: base.Add(24 * time.Hour)},
+		{Category: "[MotoGP]", Name: "Same", Session: "Sprint", Time: base.Add(24 * time.Hour)},
+		{Category: "", Name: "NoCategory", Session: "Race", Time: base},
+		{Category: "[Formula 1]", Name: " ", Session: "Race", Time: base},
+		{Category: "[Formula 1]", Name: "NoSession", Session: "", Time: base},
+		{Category: "[Formula 1]", Name: "NoDate", Session: "Race"},
+		{Category: "[Formula 1]", Name: "Past", Session: "Race", Time: base.AddDate(-1, 0, 0)},
+	}), base
+}
+
+func TestIndexEvents(t *testing.T) {
+	index, _ := testIndex()
+	want := []string{"Past", "Early", "Mid", "Same", "Late"}
+	if got := eventNames(index.Between(time.Time{}, time.Time{})); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexEvents = %q, want %q", got, want)
+	}
+	if got := eventNames(indexEvents("events.csv", nil).Between(time.Time{}, time.Time{})); got != nil {
+		t.Errorf("empty index = %q", got)
+	}
+}
+
+func TestEventIndexBetween(t *testing.T) {
+	index, base := testIndex()
+	day := 24 * time.Hour
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{"everything", time.Time{}, time.Time{}, []string{"Past", "Early", "Mid", "Same", "Late"}},
+		{"from the start of an event", base, time.Time{}, []string{"Early", "Mid", "Same", "Late"}},
+		{"from just after an event", base.Add(time.Second), time.Time{}, []string{"Mid", "Same", "Late"}},
+		{"until the start of an event", base, base.Add(day), []string{"Early"}},
+		{"until just after an event", base, base.Add(day + time.Second), []string{"Early", "Mid", "Same"}},
+		{"events at the same time", base.Add(day), base.Add(day + time.Second), []string{"Mid", "Same"}},
+		{"nothing in between", base.Add(time.Hour), base.Add(2 * time.Hour), nil},
+		{"after every event", base.Add(3 * day), time.Time{}, nil},
+		{"until before every event", time.Time{}, base.AddDate(-2, 0, 0), nil},
+		{"to before from", base.Add(2 * day), base, nil},
+	}
+	for _, test := range tests {
+		if got := eventNames(index.Between(test.from, test.to)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Between = %q, want %q", test.name, got, test.want)
+		}
+	}
+	// The events returned can be changed without changing the index.
+	events := index.Between(time.Time{}, time.Time{})
+	events[0].Name = "Changed"
+	if got := index.Between(time.Time{}, time.Time{})[0].Name; got != "Past" {
+		t.Errorf("Between returned the events of the index, which now starts with %q", got)
+	}
+}
+
+func TestEventIndexNext(t *testing.T) {
+	index, base := testIndex()
+	tests := []struct {
+		name  string
+		next  func() (Event, bool)
+		want  string
+		found bool
+	}{
+		{"any at the start of an event", func() (Event, bool) { return index.Next(base, func(Event) bool { return true }) }, "Early", true},
+		{"any just after an event", func() (Event, bool) { return index.Next(base.Add(time.Second), func(Event) bool { return true }) }, "Mid", true},
+		{"any after every event", func() (Event, bool) { return index.Next(base.AddDate(1, 0, 0), func(Event) bool { return true }) }, "", false},
+		{"category", func() (Event, bool) { return index.NextInCategory("formula", base.Add(time.Second)) }, "Late", true},
+		{"category in upper case", func() (Event, bool) { return index.NextInCategory("MOTOGP", base) }, "Mid", true},
+		{"unknown category", func() (Event, bool) { return index.NextInCategory("indycar", base) }, "", false},
+		{"session", func() (Event, bool) { return index.NextInSession("race", base) }, "Mid", true},
+		{"session after its last event", func() (Event, bool) { return index.NextInSession("sprint", base.AddDate(0, 0, 2)) }, "", false},
+		{"past events are skipped", func() (Event, bool) { return index.NextInSession("race", base.AddDate(-2, 0, 0)) }, "Past", true},
+	}
+	for _, test := range tests {
+		e, found := test.next()
+		if found != test.found || e.Name != test.want {
+			t.Errorf("%s: got %q, %v, want %q, %v", test.name, e.Name, found, test.want, test.found)
+		}
+	}
+}
+
+func TestEventIndexNumbers(t *testing.T) {
+	index, base := testIndex()
+	tests := []struct {
+		number string
+		want   string
+		err    bool
+	}{
+		{"1", "Past", false},
+		{" 2 ", "Early", false},
+		{"5", "Late", false},
+		{"0", "", true},
+		{"6", "", true},
+		{"-1", "", true},
+		{"two", "", true},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		e, err := index.Event(test.number)
+		if (err != nil) != test.err || e.Name != test.want {
+			t.Errorf("Event(%q) = %q, %v, want %q, error %v", test.number, e.Name, err, test.want, test.err)
+		}
+	}
+	// The number of the first upcoming event is the one the list of the event command starts at.
+	for _, now := range []time.Time{base, base.Add(time.Second), base.AddDate(1, 0, 0)} {
+		e, err := index.Event(strconv.Itoa(index.Number(now)))
+		next, found := index.Next(now, func(Event) bool { return true })
+		if found != (err == nil) || e.Name != next.Name {
+			t.Errorf("Number(%v) is event %q, want %q", now, e.Name, next.Name)
+		}
+	}
+}
+
+func TestEventPeriod(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2030, 5, 1, 10, 30, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2030, 5, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		period   string
+		now      time.Time
+		from, to time.Time
+		err      bool
+	}{
+		{"", now, now, time.Time{}, false},
+		{"today", now, now, day(2), false},
+		{"week", now, now, now.AddDate(0, 0, 7), false},
+		{"weekend", now, day(3), day(6), false},
+		{"weekend", time.Date(2030, 5, 4, 12, 0, 0, 0, time.UTC), time.Date(2030, 5, 4, 12, 0, 0, 0, time.UTC), day(6), false},
+		{"weekend", time.Date(2030, 5, 6, 12, 0, 0, 0, time.UTC), day(10), day(13), false},
+		{"3", now, now, now.AddDate(0, 0, 3), false},
+		{"366", now, now, now.AddDate(0, 0, 366), false},
+		{"0", now, now, time.Time{}, true},
+		{"367", now, now, time.Time{}, true},
+		{"fortnight", now, now, time.Time{}, true},
+	}
+	for _, test := range tests {
+		from, to, err := eventPeriod(test.period, test.now)
+		if (err != nil) != test.err {
+			t.Errorf("eventPeriod(%q, %v) error = %v, want error %v", test.period, test.now, err, test.err)
+			continue
+		}
+		if !test.err && (!from.Equal(test.from) || !to.Equal(test.to)) {
+			t.Errorf("eventPeriod(%q, %v) = %v, %v, want %v, %v", test.period, test.now, from, to, test.from, test.to)
+		}
+	}
+}
+
+func TestApplyEventChanges(t *testing.T) {
+	event := Event{Category: "[Formula 1]", Name: "Bahrain Grand Prix", Session: "Race", Time: time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC),
+		Channel: "111111111111111111", Mention: "<@&222222222222222222>", Image: "https://example.com/f1.png"}
+	tests := []struct {
+		changes map[string]interface{}
+		want    Event
+		err     bool
+	}{
+		{map[string]interface{}{"channel": "<#333333333333333333>", "mention": "444444444444444444"},
+			Event{Channel: "333333333333333333", Mention: "<@&444444444444444444>", Image: event.Image}, false},
+		{map[string]interface{}{"channel": "none", "mention": " None ", "image": "NONE"}, Event{}, false},
+		{map[string]interface{}{"channel": "general"}, Event{}, true},
+		{map[string]interface{}{"mention": "<@555555555555555555>"}, Event{}, true},
+		{map[string]interface{}{"channel": 333333333333333333}, Event{}, true},
+	}
+	for _, test := range tests {
+		e := event
+		err := applyEventChanges(&e, test.changes, time.UTC)
+		if (err != nil) != test.err {
+			t.Errorf("applyEventChanges(%v) error = %v, want error %v", test.changes, err, test.err)
+			continue
+		}
+		if !test.err && (e.Channel != test.want.Channel || e.Mention != test.want.Mention || e.Image != test.want.Image) {
+			t.Errorf("applyEventChanges(%v) = %+v, want %+v", test.changes, e, test.want)
+		}
+	}
+}
+
+func TestGuildEventsSQLite(t *testing.T) {
+	conf.Store(defaultConfig())
+	path := filepath.Join(t.TempDir(), "glucord.db")
+	bot, err := NewSQLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bot.Close()
+	saved := store
+	store = bot
+	defer func() { store = saved }()
+	base := time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)
+	err = updateEvents("", func(events []Event) ([]Event, error) {
+		return append(events, Event{Category: "[Formula 1]", Name: "Bahrain Grand Prix", Session: "Race", Time: base}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := guildEvents("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventNames(index.Between(time.Time{}, time.Time{})); !reflect.DeepEqual(got, []string{"Bahrain Grand Prix"}) {
+		t.Fatalf("events after updateEvents = %v", got)
+	}
+	// The index is kept while the database doesn't change.
+	if again, _ := guildEvents(""); again != index {
+		t.Errorf("guildEvents read the events again without any change")
+	}
+	// Changes made by another program are picked up.
+	other, err := NewSQLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	err = other.UpdateEvents(func(events []Event) ([]Event, error) {
+		return append(events, Event{Category: "[MotoGP]", Name: "Qatar Grand Prix", Session: "Race", Time: base.Add(time.Hour)}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err = guildEvents("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventNames(index.Between(time.Time{}, time.Time{})); !reflect.DeepEqual(got, []string{"Bahrain Grand Prix", "Qatar Grand Prix"}) {
+		t.Errorf("events after another program changed them = %v", got)
+	}
+}
@@ -0,0 +1,383 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	icsTimeFormat = "20060102T150405Z" // Time format of the UTC dates of iCalendar files.
+	icsLocalTime  = "20060102T150405"  // Time format of the dates of iCalendar files with a time zone or floating.
+	icsMaxSize    = 4 << 20            // Maximum size of the iCalendar files imported from a URL.
+)
+
+// Type that represents an event (VEVENT) read from an iCalendar file.
+type icsEvent struct {
+	Summary    string
+	Categories []string
+	Start      time.Time
+	AllDay     bool
+	Cancelled  bool
+}
+
+// Client used to download the iCalendar files to import, so that a slow server doesn't hold the command forever.
+// It only connects to public addresses, checked when connecting so that redirects and DNS can't get around it.
+var icsClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return checkPublicIP(net.ParseIP(host))
+		}}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// The checkPublicIP function checks that an address is on the internet, rather than on the machine of the bot or
+// on its network, which the URLs given to the event command must not reach.
+func checkPublicIP(ip net.IP) error {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%s is not a public address", ip)
+	}
+	return nil
+}
+
+// The fetchICS function downloads an iCalendar file and returns its events. Subscription links (webcal://) are
+// downloaded over https, as that is what they point to. Only http and https links to public addresses are
+// downloaded, and files larger than icsMaxSize are refused.
+func fetchICS(link string) ([]icsEvent, error) {
+	if strings.HasPrefix(strings.ToLower(link), "webcal://") {
+		link = "https://" + link[len("webcal://"):]
+	}
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, errors.New("expected an http, https or webcal URL")
+	}
+	resp, err := icsClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", link, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, icsMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > icsMaxSize {
+		return nil, fmt.Errorf("%s: larger than %d MB", link, icsMaxSize>>20)
+	}
+	return parseICS(bytes.NewReader(data))
+}
+
+// The parseICS function reads the events of an iCalendar file (RFC 5545).
+// Only what the events file can hold is kept. Recurring events are read as their first occurrence, as the calendars
+// of the championships list every session on its own.
+func parseICS(r io.Reader) (events []icsEvent, err error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), icsMaxSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// Long lines are folded into several ones, which start with a space or a tab after the first one.
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	var current *icsEvent
+	found := false
+	for _, line := range lines {
+		name, params, value, ok := icsProperty(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			found = true
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &icsEvent{}
+		case name == "END" && strings.EqualFold(value, "VEVENT") && current != nil:
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+		case name == "SUMMARY":
+			current.Summary = icsUnescape(value)
+		case name == "CATEGORIES":
+			for _, category := range icsSplit(value) {
+				if category = strings.TrimSpace(icsUnescape(category)); category != "" {
+					current.Categories = append(current.Categories, category)
+				}
+			}
+		case name == "STATUS":
+			current.Cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			current.Start, current.AllDay, err = icsTime(value, params)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !found {
+		return nil, errors.New("not an iCalendar file")
+	}
+	return
+}
+
+// The icsProperty function splits a line of an iCalendar file into the name, parameters and value of its property.
+// Parameter values can be quoted, in which case they may contain colons and semicolons.
+func icsProperty(line string) (name string, params map[string]string, value string, ok bool) {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			parts := strings.Split(line[:i], ";")
+			name = strings.ToUpper(strings.TrimSpace(parts[0]))
+			params = make(map[string]string)
+			for _, param := range parts[1:] {
+				if k, v, found := strings.Cut(param, "="); found {
+					params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+				}
+			}
+			return name, params, line[i+1:], name != ""
+		}
+	}
+	return
+}
+
+// The icsTime function parses a date of an iCalendar file, which can be in UTC, on the time zone given by its TZID
+// parameter or, without either, floating, which is read as UTC. Dates without a time are whole day events.
+func icsTime(value string, params map[string]string) (t time.Time, allDay bool, err error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err = time.Parse("20060102", value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(icsTimeFormat, value)
+		return
+	}
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		loc, err = time.LoadLocation(tzid)
+		if err != nil {
+			log.Println("icsTime: unknown time zone", tzid, "read as UTC")
+			loc, err = time.UTC, nil
+		}
+	}
+	t, err = time.ParseInLocation(icsLocalTime, value, loc)
+	return t.UTC(), false, err
+}
+
+// Small utility function that splits a list value of an iCalendar file on its commas, except the escaped ones.
+func icsSplit(value string) (parts []string) {
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// Small utility function that removes the escaping of a text value of an iCalendar file.
+func icsUnescape(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// Small utility function that escapes a text value for an iCalendar file.
+func icsEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`).Replace(value)
+}
+
+// The importICS function adds the events of an iCalendar file to events, with the given category or, if it is empty,
+// the first category of each event. The summary of each event is split into the name and the session on its last
+// " - ", like "Bahrain Grand Prix - Race". Events already on the events file, with the same category, name and
+// session, get their start updated instead, so that importing a calendar again picks up the changes to it.
+// New events take the channel, image and mention of their category on the configuration of the guild or, if it
+// doesn't have the category, of the latest event of the category. Past, cancelled and whole day events are skipped.
+func importICS(guild string, events []Event, imported []icsEvent, category string) (result []Event, added, updated, skipped int) {
+	categories := cfg().guild(guild).Categories
+	for _, ie := range imported {
+		e := Event{Category: category, Time: ie.Start}
+		if e.Category == "" && len(ie.Categories) > 0 {
+			e.Category = ie.Categories[0]
+		}
+		e.Name, e.Session = ie.Summary, "Event"
+		if i := strings.LastIndex(ie.Summary, " - "); i > 0 {
+			e.Name, e.Session = strings.TrimSpace(ie.Summary[:i]), strings.TrimSpace(ie.Summary[i+3:])
+		}
+		if ie.AllDay || ie.Cancelled || time.Until(e.Time) < 0 {
+			skipped++
+			continue
+		}
+		existing := -1
+		for i, other := range events {
+			if strings.EqualFold(other.Category, e.Category) && strings.EqualFold(other.Name, e.Name) && strings.EqualFold(other.Session, e.Session) {
+				existing = i
+			}
+		}
+		if existing >= 0 {
+			if !events[existing].Time.Equal(e.Time) {
+				events[existing].Time = e.Time
+				updated++
+			}
+			continue
+		}
+		if c, ok := categories[e.Category]; ok {
+			e.Channel, e.Image, e.Mention = c.Channel, c.Image, c.Mention
+		} else {
+			defaults := categoryDefaults(events, e.Category)
+			e.Channel, e.Image, e.Mention = defaults.Channel, defaults.Image, defaults.Mention
+		}
+		if err := checkEvent(e); err != nil {
+			log.Println("importICS:", ie.Summary+":", err)
+			skipped++
+			continue
+		}
+		events = append(events, e)
+		added++
+	}
+	return events, added, updated, skipped
+}
+
+// The writeICS function writes the events matching a category (all of them if it is empty) as an
+// iCalendar file, which calendar apps can subscribe to. Each event keeps the same UID when its start changes, so
+// that the apps move it instead of adding it again. Events end after the length of their category on the
+// configuration of the guild (see eventLength).
+func writeICS(w io.Writer, guild string, events []Event, category string) error {
+	var b bytes.Buffer
+	line := func(text string) {
+		// Lines longer than 75 bytes must be folded, without splitting a character.
+		for len(text) > 75 {
+			cut := 75
+			for cut > 0 && text[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(text[:cut] + "\r\n")
+			text = " " + text[cut:]
+		}
+		b.WriteString(text + "\r\n")
+	}
+	name := "glucord"
+	if category != "" {
+		name += " " + category
+	}
+	now := time.Now().UTC().Format(icsTimeFormat)
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//glucord//events//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + icsEscape(name))
+	for _, e := range events {
+		if !strings.Contains(strings.ToLower(e.Category), strings.ToLower(category)) {
+			continue
+		}
+		uid := sha1.Sum([]byte(strings.ToLower(e.Category + "\x00" + e.Name + "\x00" + e.Session)))
+		line("BEGIN:VEVENT")
+		line("UID:" + hex.EncodeToString(uid[:]) + "@glucord")
+		line("DTSTAMP:" + now)
+		line("DTSTART:" + e.Time.UTC().Format(icsTimeFormat))
+		line("DTEND:" + e.Time.Add(eventLength(guild, e.Category)).UTC().Format(icsTimeFormat))
+		line("SUMMARY:" + icsEscape(e.Category+" "+e.Name+" "+e.Session))
+		line("CATEGORIES:" + icsEscape(e.Category))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// The calendarURL function returns the address of the calendar feed of a guild, filtered by a category if it isn't
+// empty, or an empty string if the feed isn't public (see CalendarConfig).
+func calendarURL(guild string, category string) string {
+	base := strings.TrimSuffix(cfg().Calendar.URL, "/")
+	if base == "" || cfg().Calendar.Listen == "" {
+		return ""
+	}
+	query := url.Values{}
+	if guild != "" {
+		query.Set("guild", guild)
+	}
+	if category != "" {
+		query.Set("category", category)
+	}
+	if len(query) == 0 {
+		return base + "/events.ics"
+	}
+	return base + "/events.ics?" + query.Encode()
+}
+
+// The serveCalendar function serves the calendar feed of the events of each guild over HTTP, at /events.ics with
+// the guild and optionally a category on the query, like /events.ics?guild=123&category=Formula1.
+// It runs in the background for as long as the bot runs, from when it starts.
+func serveCalendar(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events.ics", func(w http.ResponseWriter, r *http.Request) {
+		guild := r.URL.Query().Get("guild")
+		if guild == "" {
+			guild = cfg().Guild
+		}
+		if !contains(cfg().guildIDs(), guild) {
+			http.NotFound(w, r)
+			return
+		}
+		index, err := guildEvents(guild)
+		if err != nil {
+			log.Println("serveCalendar:", err)
+			http.Error(w, "error reading the events", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		err = writeICS(w, guild, index.Between(time.Now(), time.Time{}), r.URL.Query().Get("category"))
+		if err != nil {
+			log.Println("serveCalendar:", err)
+		}
+	})
+	log.Println("serveCalendar:", http.ListenAndServe(addr, mux))
+}
@@ -0,0 +1,187 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParseICS(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []icsEvent
+		err  bool
+	}{
+		{"utc", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Bahrain Grand Prix - Race\r\nCATEGORIES:Formula 1\r\n" +
+			"DTSTART:20300302T150000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "Bahrain Grand Prix - Race", Categories: []string{"Formula 1"}, Start: time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"bare newlines", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:A\nDTSTART:20300302T150000Z\nEND:VEVENT\nEND:VCALENDAR\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"folded utf-8", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Grande Prémio de São \r\n Paulo - Corrida de qualificação \xc3\r\n \xa9\r\n" +
+			"DTSTART:20300302T150000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "Grande Prémio de São Paulo - Corrida de qualificação é", Start: time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"folded with tab", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Ab\r\n\tcd\r\nDTSTART:20300302T150000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "Abcd", Start: time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"escapes", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:a\\, b\\; c\\\\d\\ne\r\nCATEGORIES:One\\,Two,Three, ,\r\n" +
+			"DTSTART:20300302T150000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: `a, b; c\d e`, Categories: []string{"One,Two", "Three"}, Start: time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"tzid", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:A\r\nDTSTART;TZID=Europe/Lisbon:20300702T150000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 7, 2, 14, 0, 0, 0, time.UTC)}}, false},
+		{"quoted tzid", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:A\r\nDTSTART;TZID=\"America/New_York\":20300102T150000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 1, 2, 20, 0, 0, 0, time.UTC)}}, false},
+		{"unknown tzid", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:A\r\nDTSTART;TZID=Mars/Olympus:20300102T150000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"floating", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:A\r\nDTSTART:20300102T150000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC)}}, false},
+		{"all day", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:A\r\nDTSTART;VALUE=DATE:20300102\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), AllDay: true}}, false},
+		{"cancelled", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:A\r\nSTATUS:CANCELLED\r\nDTSTART:20300102T150000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			[]icsEvent{{Summary: "A", Start: time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC), Cancelled: true}}, false},
+		{"properties outside events", "BEGIN:VCALENDAR\r\nSUMMARY:Calendar\r\nX-WR-CALNAME:F1\r\nEND:VCALENDAR\r\n", nil, false},
+		{"bad date", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", nil, true},
+		{"not a calendar", "<html><body>Not found</body></html>", nil, true},
+		{"empty", "", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseICS(strings.NewReader(test.in))
+		if (err != nil) != test.err {
+			t.Errorf("%s: parseICS error = %v, want error %v", test.name, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseICS = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestICSEscape(t *testing.T) {
+	for _, text := range []string{"", "plain", "a, b; c", `back\slash`, `\,`, "Grande Prémio, São Paulo; 2030"} {
+		if got := icsUnescape(icsEscape(text)); got != text {
+			t.Errorf("icsUnescape(icsEscape(%q)) = %q", text, got)
+		}
+	}
+	if got := icsSplit(icsEscape("a,b") + "," + icsEscape("c;d")); !reflect.DeepEqual(got, []string{`a\,b`, `c\;d`}) {
+		t.Errorf("icsSplit = %q", got)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	c := defaultConfig()
+	c.Categories = map[string]CategoryConfig{"Formula 1": {Length: 2 * time.Hour}}
+	conf.Store(c)
+	start := time.Date(2030, 3, 2, 15, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Category: "Formula 1", Name: "Grande Prémio de São Paulo, com um nome muito comprido para caber numa só linha", Session: "Corrida; sprint", Time: start},
+		{Category: "MotoGP", Name: "ñ" + strings.Repeat("é", 80), Session: "Race", Time: start.Add(time.Hour)},
+	}
+	var b bytes.Buffer
+	if err := writeICS(&b, "", events, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 bytes: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+	// Events last as long as their category says, or an hour.
+	for _, want := range []string{"DTSTART:20300302T150000Z\r\nDTEND:20300302T170000Z\r\n", "DTSTART:20300302T160000Z\r\nDTEND:20300302T170000Z\r\n"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q on:\n%s", want, b.String())
+		}
+	}
+	// Reading the calendar back gives the same events.
+	got, err := parseICS(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("parseICS read %d events, want %d", len(got), len(events))
+	}
+	for i, e := range events {
+		want := icsEvent{Summary: e.Category + " " + e.Name + " " + e.Session, Categories: []string{e.Category}, Start: e.Time}
+		if !reflect.DeepEqual(got[i], want) {
+			t.Errorf("round trip = %+v, want %+v", got[i], want)
+		}
+	}
+	// Only the events of the category are written.
+	b.Reset()
+	if err := writeICS(&b, "", events, "moto"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := parseICS(&b); len(got) != 1 || got[0].Categories[0] != "MotoGP" {
+		t.Errorf("writeICS with category = %+v", got)
+	}
+}
+
+func TestCheckPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"not an ip", false},
+	}
+	for _, test := range tests {
+		if err := checkPublicIP(net.ParseIP(test.ip)); (err == nil) != test.public {
+			t.Errorf("checkPublicIP(%s) = %v, want public %v", test.ip, err, test.public)
+		}
+	}
+}
+
+func TestFetchICS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	}))
+	defer server.Close()
+	// The server is on the loopback address, which is refused when connecting.
+	for _, link := range []string{server.URL, "webcal://" + strings.TrimPrefix(server.URL, "http://"), "http://localhost:1/events.ics"} {
+		if _, err := fetchICS(link); err == nil || !strings.Contains(err.Error(), "not a public address") {
+			t.Errorf("fetchICS(%q) = %v, want a refused address", link, err)
+		}
+	}
+	for _, link := range []string{"file:///etc/passwd", "ftp://example.com/events.ics", "gopher://example.com", "events.ics", ""} {
+		if _, err := fetchICS(link); err == nil || !strings.Contains(err.Error(), "expected an http") {
+			t.Errorf("fetchICS(%q) = %v, want a refused URL", link, err)
+		}
+	}
+}
@@ -19,45 +19,48 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
-	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 var (
-	prefix       = "!" // Prefix which is used by the user to issue commands.
-	token        = ""  // Token used to authenticate the bot with Discord.
-	guild        = ""  // Guild ID.
-	feedInterval = 300 // Feed poll interval in seconds.
-	owmAPIKey    = ""  // OWM API key.
+	conf  atomic.Value // Current configuration of the bot (*Config), replaced as a whole when it is reloaded.
+	store Store        // Storage backend used to load and save the bot's data.
 )
 
 const (
-	aliasFile     = "alias.csv"    // Full path to the alias file.
-	answersFile   = "answers.csv"  // Full path to the answers file.
-	betFile       = "bet.csv"      // Full path to the bet file.
-	betsFile      = "bets.csv"     // Full path to the bets file.
-	disabledFile  = "disabled.csv" // Full path to the disabled file.
-	configFile    = "config.csv"   // Full path to the config file.
-	driversFile   = "drivers.csv"  // Full path to the drivers file.
-	eventsFile    = "events.csv"   // Full path to the events file.
-	feedsFile     = "feeds.csv"    // Full path to the feeds file.
-	inputFile     = "input.txt"    // Full path to the input file.
-	pluginsFolder = "./plugins/"   // Full path to the plugins folder.
-	quotesFile    = "quotes.csv"   // Full path to the quotes file.
-	resultsFile   = "results.csv"  // Full path to the results file.
-	rolesFile     = "roles.csv"    // Full path to the roles file.
-	statsFile     = "stats.csv"    // Full path to the stats file.
-	usageFile     = "usage.csv"    // Full path to the usage file.
-	usersFile     = "users.csv"    // Full path to the users file.
-	weatherFile   = "weather.csv"  // Full path to the weather file.
-	hns           = 3600000000000  // Number of nanoseconds in one hour.
+	aliasFile        = "alias.csv"      // Default full path to the alias file.
+	answersFile      = "answers.csv"    // Default full path to the answers file.
+	betFile          = "bet.csv"        // Default full path to the bet file.
+	betsFile         = "bets.csv"       // Default full path to the bets file.
+	configFile       = "config.toml"    // Full path to the config file (can be changed with GLUCORD_CONFIG).
+	databaseFile     = "glucord.db"     // Default full path to the database file.
+	disabledFile     = "disabled.csv"   // Default full path to the disabled file.
+	driversFile      = "drivers.csv"    // Default full path to the drivers file.
+	eventsFile       = "events.csv"     // Default full path to the events file.
+	feedsFile        = "feeds.csv"      // Default full path to the feeds file.
+	inputFile        = "input.txt"      // Default full path to the input file.
+	legacyConfigFile = "config.csv"     // Full path to the config file used by older versions.
+	pluginsFolder    = "./plugins/"     // Default full path to the plugins folder.
+	quotesFile       = "quotes.csv"     // Default full path to the quotes file.
+	remindersFile    = "reminders.csv"  // Default full path to the reminders file.
+	resultsFile      = "results.csv"    // Default full path to the results file.
+	rolesFile        = "roles.csv"      // Default full path to the roles file.
+	statsFile        = "stats.csv"      // Default full path to the stats file.
+	templatesFile    = "templates.tmpl" // Default full path to the templates file.
+	usageFile        = "usage.csv"      // Default full path to the usage file.
+	usersFile        = "users.csv"      // Default full path to the users file.
+	weatherFile      = "weather.csv"    // Default full path to the weather file.
+	hns              = 3600000000000    // Number of nanoseconds in one hour.
 )
 
 // Message callback function that receives a Discord session pointer and a message pointer.
@@ -67,100 +70,173 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 	m.Content = strings.Trim(m.Content, " ")
-	command, err := parseCommand(m.Content, m.Author.ID, m.ChannelID)
-	if err != nil {
+	command, err := parseCommand(m.Content, m.Author.ID, m.ChannelID, m.GuildID)
+	if errors.Is(err, errNotCommand) {
+		return
+	} else if err != nil {
+		s.ChannelMessageSend(m.ChannelID, userTemplates(m.GuildID, m.Author.ID).Text("invalid_arguments", vars{"Error": err}))
 		return
 	} else {
-		// Pick the corresponding function for each supported command and store its output.
-		// If the command is not built-in, run it as a plugin inside a dedicated goroutine.
-		disabled, err := readCSV(disabledFile)
-		if err != nil {
-			log.Println("main:", err)
+		// Pick the corresponding command from the registry and store its output.
+		// If the command is not built-in, run it as a plugin.
+		// Commands can be disabled on a channel, on a category or on the whole server (see disabledHere).
+		name := strings.ToLower(command.Name)
+		spec, builtin := lookupCommand(name)
+		if builtin {
+			name = spec.Name
 		}
-		for _, v := range disabled {
-			if strings.EqualFold(v[0], command.Name) {
-				s.ChannelMessageSend(command.Channel, ":warning: Unkown command or plugin.")
-				return
-			}
+		if message := disabledHere(s, command.Guild, command.Channel, command.User, command.Name, name); message != "" {
+			s.ChannelMessageSend(command.Channel, message)
+			return
+		}
+		// Commands with a cooldown can only be used again by the same user or on the same channel after a while.
+		if wait := cooldownWait(name, command.User, command.Channel); wait > 0 {
+			s.ChannelMessageSend(command.Channel, cooldownMessage(command.Guild, command.User, wait))
+			return
 		}
+		// The output goes to the channel, where the user is told to wait if the command takes long to run.
+		reply := channelReply(s, command.Guild, command.Channel, command.User)
+		defer reply.Close()
 		var do *DiscordOutput
-		switch strings.ToLower(command.Name) {
-		case "a", "ask":
-			do = cmdAsk(s, command.Channel, command.User, command.Args)
-		case "b", "bet":
-			do = cmdBet(s, command.Channel, command.User, command.Args)
-		case "h", "help", "commands":
-			do = cmdHelp(s, command.Channel, command.User, strings.Join(command.Args, ""))
-		case "n", "next":
-			do = cmdNext(s, command.Channel, command.User, strings.Join(command.Args, " "))
-		case "p", "ping":
-			do = cmdPing(s, command.Channel, command.User, command.Args)
-		case "pb", "processbets":
-			do = cmdProcessBets(s, command.Channel, command.User)
-		case "q", "quote":
-			do = cmdQuote(s, command.Channel, command.User, command.Args)
-		case "r", "register":
-			do = cmdRegister(s, command.Channel, command.User)
-		case "ro", "roles":
-			do = cmdRoles(s, command.Channel, command.User, command.Args)
-		case "s", "stats":
-			cmdStats(s, command.Channel, command.User)
-		case "w", "weather":
-			do = cmdWeather(s, command.Channel, command.User, command.Args)
-		default:
-			finishedCh := make(chan bool)
-			go func() {
-				select {
-				case <-finishedCh:
-					// We received true from the finished channel, so we do nothing.
-				case <-time.After(3 * time.Second):
-					// We didn't receive from the finished channel within 3 seconds.
-					s.ChannelMessageSend(command.Channel, ":warning: Command is taking long to run... Please wait.")
-				}
-			}()
-			go cmdPlugin(strings.ToLower(command.Name), s, command.Channel, command.User, command.Args, finishedCh)
+		if builtin {
+			do = spec.run(s, command)
+		} else {
+			cooldownRecord(name, command.User, command.Channel)
+			do = cmdPlugin(name, s, command.Guild, command.Channel, command.User, command.Args)
 		}
-		// If the pointer to DiscordOutput isn't nil (built-in command) send the output here.
-		// This is to prevent access to methods on a nil pointer (cmdPlugin does not set do).
 		if do != nil {
-			if do.Embeds {
-				s.ChannelMessageSendEmbed(command.Channel, do.Embed())
-			} else {
-				s.ChannelMessageSend(command.Channel, do.Text())
+			_, err = reply.Send(do)
+			if err != nil {
+				log.Println("main:", err)
 			}
 		}
 	}
 
 }
 
+// Interaction callback function that receives a Discord session pointer and an interaction pointer.
+// If the interaction is a slash command of the registry, it runs the command and replies with its output.
+// Interactions with components (buttons, select menus and modals) are passed on to the component router and
+// autocomplete interactions are answered with suggestions for the option being typed.
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		routeComponent(s, i, i.MessageComponentData().CustomID)
+		return
+	case discordgo.InteractionModalSubmit:
+		routeComponent(s, i, i.ModalSubmitData().CustomID)
+		return
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		autocomplete(s, i)
+		return
+	case discordgo.InteractionApplicationCommand:
+	default:
+		return
+	}
+	spec, ok := lookupCommand(i.ApplicationCommandData().Name)
+	if !ok {
+		return
+	}
+	command := interactionCommand(spec, i)
+	if message := disabledHere(s, command.Guild, command.Channel, command.User, spec.Name); message != "" {
+		respondText(s, i, message)
+		return
+	}
+	if wait := cooldownWait(spec.Name, command.User, command.Channel); wait > 0 {
+		respondText(s, i, cooldownMessage(command.Guild, command.User, wait))
+		return
+	}
+	respond(s, i, spec.Ephemeral, func() *DiscordOutput {
+		return spec.run(s, command)
+	})
+}
+
+// Handlers of the components sent by the bot and of the modals it shows, by the first part of their custom ID.
+// Custom IDs are made of colon separated parts, like "vote:2", and the handler gets the parts after the first one.
+// Components keep working after the bot restarts, so handlers must not assume the message was sent by this process.
+var componentHandlers map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate, args []string)
+
+func init() {
+	componentHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate, args []string){
+		"bet":    componentBet,
+		"mydata": componentMyData,
+		"page":   turnPage,
+		"roles":  componentRoles,
+		"vote":   componentVote,
+	}
+}
+
+// The routeComponent function passes an interaction with a component or a modal to the handler of its custom ID.
+func routeComponent(s *discordgo.Session, i *discordgo.InteractionCreate, customID string) {
+	parts := strings.Split(customID, ":")
+	handler, ok := componentHandlers[parts[0]]
+	if !ok {
+		log.Println("routeComponent: no handler for", customID)
+		respondText(s, i, userTemplates(i.GuildID, interactionUser(i)).Text("component.unknown", nil))
+		return
+	}
+	handler(s, i, parts[1:])
+}
+
 // The main function initialises some variables from a configuration file, then sets up the bot and connects to Discord.
 func main() {
-	config, err := readCSV(configFile)
+	path := configFile
+	if env := os.Getenv("GLUCORD_CONFIG"); env != "" {
+		path = env
+	}
+	configPath = path
+	config, err := loadConfig(path)
+	if err != nil {
+		// Report every problem found on the configuration before giving up, instead of only the first one.
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			log.Println("config:", problem)
+		}
+		return
+	}
+	conf.Store(config)
+	if len(config.Admins) == 0 {
+		log.Println("config: no admins are set, admin only commands can be run by the server administrators")
+	}
+	// When run as "glucord migrate" the bot imports the CSV files into the database and exits.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(os.Args[2:])
+		if err != nil {
+			log.Println("migrate:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	store, err = openStore(config.Storage.Backend, config.Storage.Database)
 	if err != nil {
 		log.Println("main:", err)
 		return
 	}
-	prefix = config[0][0]
-	token = config[0][1]
-	guild = config[0][2]
-	feedInterval, _ = strconv.Atoi(config[0][3])
-	owmAPIKey = config[0][4]
-	dg, err := discordgo.New("Bot " + token)
+	defer store.Close()
+	// User settings kept outside of the users file by older versions are merged into it (the database does it
+	// on its own schema migrations).
+	if cs, ok := store.(*csvStore); ok {
+		summary, err := mergeProfiles(cs)
+		if err != nil {
+			log.Println("main:", err)
+			return
+		}
+		for _, line := range summary {
+			log.Println("main:", line)
+		}
+	}
+	dg, err := discordgo.New("Bot " + config.Token)
 	if err != nil {
 		log.Println("main:", err)
 		return
 	}
+	// Every message sent by the bot goes through the rate limit, including the ones sent by plugins and tasks.
+	dg.Client.Transport = &limitedTransport{base: http.DefaultTransport}
 	// Add callback function to handle messages and fire up the appropriate regular command function.
 	dg.AddHandler(messageCreate)
 	// Add callback function to handle interactions and fire up the appropriate slash command function.
-	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		// Slash command names are mapped to corresponding handler functions on the commandHandlers variable.
-		// If the name of the slash command is a valid key of commandHandlers, execute the handler function.
-		if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
-			h(s, i)
-		}
-	})
-	dg.Identify.Intents = discordgo.IntentsGuildMessages
+	dg.AddHandler(interactionCreate)
+	// The guilds intent keeps the channels on the state, which is where the disabled commands look up categories.
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages
 	err = dg.Open()
 	if err != nil {
 		log.Println("main:", err)
@@ -173,15 +249,17 @@ func main() {
 	go tskFeeds(dg)
 	go tskStats(dg)
 	go tskWrite(dg)
-	// Keep a record of all the slash commands defined in the commands variable using a slice.
-	// Register a slash command on Discord for every command defined in the commands variable.
-	registeredCommands := make([]*discordgo.ApplicationCommand, len(commands))
-	for i, v := range commands {
-		cmd, err := dg.ApplicationCommandCreate(dg.State.User.ID, guild, v)
+	go tskReload(dg)
+	if config.Calendar.Listen != "" {
+		go serveCalendar(config.Calendar.Listen)
+	}
+	// Register the slash commands of the registry on each guild, unless they are already up to date.
+	// They are kept registered when the bot exits, so that restarting it doesn't make them disappear for a while.
+	for _, id := range config.guildIDs() {
+		err = syncCommands(dg, id)
 		if err != nil {
 			log.Println("main:", err)
 		}
-		registeredCommands[i] = cmd
 	}
 	// The work of the main goroutine of the bot, which is to set it up, is done by this point.
 	// However, we need to prevent it from finishing and kill all other goroutines prematurely.
@@ -190,13 +268,31 @@ func main() {
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
-	// Unregister a slash command on Discord for every command defined in the commands variable.
-	// This runs after a termination signal is caught to delete any slash commands from Discord.
-	for _, v := range registeredCommands {
-		err := dg.ApplicationCommandDelete(dg.State.User.ID, guild, v.ID)
-		if err != nil {
-			log.Println("main:", err)
-		}
-	}
 	dg.Close()
 }
+
+// The runMigrate function implements the migrate subcommand, which imports all the CSV data files into the database.
+// It accepts a -db flag to choose the database file and a -force flag to overwrite a database that already has data.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	db := flags.String("db", cfg().Storage.Database, "path to the database file")
+	force := flags.Bool("force", false, "overwrite any data already on the database")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	dst, err := NewSQLStore(*db)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	summary, err := importCSV(NewCSVStore().(*csvStore), dst, *force)
+	if err != nil {
+		return err
+	}
+	for _, line := range summary {
+		log.Println("migrate:", line)
+	}
+	log.Println("migrate: data imported into", *db+". Set the storage backend to sqlite on the configuration to use it.")
+	return nil
+}
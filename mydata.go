@@ -0,0 +1,188 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Type that represents everything the bot stores about a user, as exported by the mydata command.
+// Quotes and polls aren't included, as the bot doesn't keep who added a quote or who voted on a poll.
+type UserData struct {
+	User     string
+	Exported time.Time
+	Profile  *User       // Profile of the user (users file), if any.
+	Guilds   []GuildData // Data of the user on each partition of the data (see Config.partition).
+}
+
+// Type that represents the data of a user on the files of a partition, which is empty for the files section.
+type GuildData struct {
+	Partition string
+	Bettor    *Bettor
+	Bets      []Bet
+	Stats     *Stat
+}
+
+// The collectUserData function gathers everything stored about a user, on every partition of the data.
+func collectUserData(user string) (data UserData, err error) {
+	data = UserData{User: user, Exported: time.Now().UTC()}
+	u, err := store.User(user)
+	if err == nil {
+		data.Profile = &u
+	} else if !errors.Is(err, ErrNotFound) {
+		return
+	}
+	for _, partition := range cfg().partitions() {
+		st := store.Guild(partition)
+		guild := GuildData{Partition: partition}
+		bettors, err := st.Bettors()
+		if err != nil {
+			return data, err
+		}
+		for _, b := range bettors {
+			if strings.EqualFold(b.ID, user) {
+				b := b
+				guild.Bettor = &b
+			}
+		}
+		bets, err := st.Bets()
+		if err != nil {
+			return data, err
+		}
+		for _, b := range bets {
+			if strings.EqualFold(b.User, user) {
+				guild.Bets = append(guild.Bets, b)
+			}
+		}
+		stats, err := st.Stats()
+		if err != nil {
+			return data, err
+		}
+		for _, s := range stats {
+			if strings.EqualFold(s.User, user) {
+				s := s
+				guild.Stats = &s
+			}
+		}
+		if guild.Bettor != nil || guild.Bets != nil || guild.Stats != nil {
+			data.Guilds = append(data.Guilds, guild)
+		}
+	}
+	return
+}
+
+// The deleteUserData function removes everything stored about a user, on every partition of the data.
+// The profile, points and message counts of the user are removed, while the bets are kept under an anonymous ID,
+// so that the points of each race and the history of the bets stay the same for everyone else.
+func deleteUserData(user string) error {
+	token := make([]byte, 4)
+	_, err := rand.Read(token)
+	if err != nil {
+		return err
+	}
+	anonymous := "deleted-" + hex.EncodeToString(token)
+	err = store.UpdateUsers(func(users []User) ([]User, error) {
+		return removeRecords(users, func(u User) bool { return strings.EqualFold(u.ID, user) })
+	})
+	if err != nil {
+		return err
+	}
+	forgetStats(user)
+	for _, partition := range cfg().partitions() {
+		st := store.Guild(partition)
+		err = st.UpdateBettors(func(bettors []Bettor) ([]Bettor, error) {
+			return removeRecords(bettors, func(b Bettor) bool { return strings.EqualFold(b.ID, user) })
+		})
+		if err != nil {
+			return err
+		}
+		err = st.UpdateBets(func(bets []Bet) ([]Bet, error) {
+			changed := false
+			for i := range bets {
+				if strings.EqualFold(bets[i].User, user) {
+					bets[i].User = anonymous
+					changed = true
+				}
+			}
+			if !changed {
+				return nil, ErrNoChange
+			}
+			return bets, nil
+		})
+		if err != nil {
+			return err
+		}
+		err = st.UpdateStats(func(stats []Stat) ([]Stat, error) {
+			return removeRecords(stats, func(s Stat) bool { return strings.EqualFold(s.User, user) })
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Small utility function that removes the records matching remove, or returns ErrNoChange if none do.
+func removeRecords[T any](records []T, remove func(record T) bool) ([]T, error) {
+	kept := records[:0]
+	for _, record := range records {
+		if !remove(record) {
+			kept = append(kept, record)
+		}
+	}
+	if len(kept) == len(records) {
+		return nil, ErrNoChange
+	}
+	return kept, nil
+}
+
+// The exportFile function returns the data of a user as a file to attach to a message, either as JSON or as a ZIP
+// file holding the JSON file.
+func exportFile(data UserData, format string) (*discordgo.File, error) {
+	text, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	name := "mydata-" + data.User + ".json"
+	if format != "zip" {
+		return &discordgo.File{Name: name, ContentType: "application/json", Reader: bytes.NewReader(text)}, nil
+	}
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	w, err := archive.Create(name)
+	if err == nil {
+		_, err = w.Write(text)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &discordgo.File{Name: "mydata-" + data.User + ".zip", ContentType: "application/zip", Reader: &buffer}, nil
+}
@@ -0,0 +1,184 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Type that represents a message showing the pages of an output one at a time.
+// Messages sent as a reply to an interaction can only be edited through it, so it is kept for those.
+type pagination struct {
+	pages       []Page
+	current     int
+	interaction *discordgo.Interaction
+	tpl         *Templates // Templates of the reply, which label the buttons.
+}
+
+var (
+	paginationsMu   sync.Mutex                     // Protects paginations.
+	paginations     = make(map[string]*pagination) // Paginated messages whose buttons still work, by message ID.
+	paginationLimit = 10 * time.Minute             // How long the buttons of a paginated message work.
+)
+
+// The splitText function splits text into chunks of at most limit characters.
+// Chunks end at line boundaries whenever possible and lines longer than the limit are split on their own.
+func splitText(text string, limit int) (chunks []string) {
+	var chunk strings.Builder
+	size := 0
+	flush := func() {
+		if strings.TrimSpace(chunk.String()) != "" {
+			chunks = append(chunks, strings.TrimRight(chunk.String(), "\n"))
+		}
+		chunk.Reset()
+		size = 0
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		length := utf8.RuneCountInString(line)
+		if size+length > limit {
+			flush()
+		}
+		for length > limit {
+			runes := []rune(line)
+			chunks = append(chunks, string(runes[:limit]))
+			line = string(runes[limit:])
+			length -= limit
+		}
+		chunk.WriteString(line)
+		size += length
+	}
+	flush()
+	if chunks == nil {
+		chunks = []string{text}
+	}
+	return
+}
+
+// Small utility function that shortens a string to at most limit characters, ending it with an ellipsis if needed.
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// The pageButtons function returns the buttons of a paginated message showing the page at index out of total,
+// labelled on the language of the templates. The custom ID of each button holds the page it goes to, so turning a
+// page doesn't need to remember the current one.
+func pageButtons(tpl *Templates, index int, total int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    tpl.Text("pages.previous", nil),
+					Style:    discordgo.SecondaryButton,
+					CustomID: "page:" + strconv.Itoa(index-1),
+					Disabled: index == 0,
+				},
+				discordgo.Button{
+					Label:    fmt.Sprintf("%d/%d", index+1, total),
+					Style:    discordgo.SecondaryButton,
+					CustomID: "page:current",
+					Disabled: true,
+				},
+				discordgo.Button{
+					Label:    tpl.Text("pages.next", nil),
+					Style:    discordgo.SecondaryButton,
+					CustomID: "page:" + strconv.Itoa(index+1),
+					Disabled: index == total-1,
+				},
+			},
+		},
+	}
+}
+
+// The paginate function remembers the pages shown by a paginated message, so that its buttons can turn them.
+// After a while they are forgotten and the buttons removed, to keep memory from growing with every long output.
+// The interaction is only given for messages sent as the reply to an interaction, and the templates are those that
+// label the buttons.
+func paginate(s *discordgo.Session, m *discordgo.Message, interaction *discordgo.Interaction, pages []Page, tpl *Templates) {
+	paginationsMu.Lock()
+	p := &pagination{pages: pages, interaction: interaction, tpl: tpl}
+	paginations[m.ID] = p
+	paginationsMu.Unlock()
+	time.AfterFunc(paginationLimit, func() {
+		paginationsMu.Lock()
+		delete(paginations, m.ID)
+		page := p.pages[p.current]
+		paginationsMu.Unlock()
+		var err error
+		// Only the page buttons are removed, the components of the output itself keep working.
+		components := append([]discordgo.MessageComponent{}, page.Components...)
+		if interaction != nil {
+			_, err = s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{Components: &components})
+		} else {
+			// Editing a message replaces all its embeds, so the embed of the page being shown is sent again.
+			edit := discordgo.NewMessageEdit(m.ChannelID, m.ID)
+			edit.Components = components
+			edit.Embeds = page.message(nil).Embeds
+			_, err = s.ChannelMessageEditComplex(edit)
+		}
+		if err != nil {
+			log.Println("paginate:", err)
+		}
+	})
+}
+
+// The turnPage function handles the buttons of paginated messages, showing the page the button goes to.
+func turnPage(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	index, err := strconv.Atoi(field(args, 0))
+	paginationsMu.Lock()
+	p, ok := paginations[i.Message.ID]
+	if ok && err == nil && index >= 0 && index < len(p.pages) {
+		p.current = index
+	}
+	paginationsMu.Unlock()
+	if !ok {
+		respondText(s, i, userTemplates(i.GuildID, interactionUser(i)).Text("pages.expired", nil))
+		return
+	}
+	response := &discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage}
+	switch {
+	case err != nil || index < 0 || index >= len(p.pages):
+		response.Type = discordgo.InteractionResponseDeferredMessageUpdate
+	default:
+		page := p.pages[index]
+		response.Data = &discordgo.InteractionResponseData{
+			Content:    page.Content,
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: page.message(pageButtons(p.tpl, index, len(p.pages))).Components,
+		}
+		if page.Embed != nil {
+			response.Data.Embeds = []*discordgo.MessageEmbed{page.Embed}
+		}
+	}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		log.Println("turnPage:", err)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const backupCount = 3 // Number of rotating backups kept for each data file (file.1 is the most recent).
+
+// Each data file has its own mutex so that writers of different files don't block each other.
+// The mutexes are created on demand and never removed, as the set of data files is small and fixed.
+var fileLocks sync.Map
+
+// Small utility function that locks the mutex of a file and returns the function that unlocks it.
+// Any read-modify-write cycle on a data file must happen while holding this lock, otherwise two
+// goroutines could read the same data and the last one to write would silently drop the other's changes.
+func lockFile(path string) (unlock func()) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	mu, _ := fileLocks.LoadOrStore(abs, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// The writeFileAtomic function replaces the contents of a file in a way that survives crashes.
+// The data is written to a temporary file on the same folder, flushed to disk and only then renamed over the
+// original file, so readers see either the old or the new contents, never a truncated file.
+// Before the rename, the current contents are kept as the most recent of a rotating set of backups.
+// Callers must hold the lock of the file (see lockFile).
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return
+	}
+	// If anything goes wrong before the rename, the temporary file is removed and the original is left untouched.
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	err = write(tmp)
+	if err != nil {
+		return
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return
+	}
+	err = tmp.Close()
+	if err != nil {
+		return
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	} else {
+		os.Chmod(tmp.Name(), 0644)
+	}
+	err = rotateBackups(path)
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return
+	}
+	// Sync the folder too, so that the rename itself is persisted. Not every platform supports this.
+	if d, dirErr := os.Open(dir); dirErr == nil {
+		d.Sync()
+		d.Close()
+	}
+	return
+}
+
+// The rotateBackups function shifts the backups of a file (file.1 becomes file.2 and so on) and copies the
+// current contents of the file to file.1. The oldest backup is dropped once there are backupCount of them.
+func rotateBackups(path string) error {
+	if backupCount < 1 || !fileExists(path) {
+		return nil
+	}
+	for i := backupCount - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", path, i)
+		if fileExists(older) {
+			err := os.Rename(older, fmt.Sprintf("%s.%d", path, i+1))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".1")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	err = dst.Sync()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
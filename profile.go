@@ -0,0 +1,155 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Time zone of the users who haven't picked one (see cmdSettings).
+const defaultTimezone = "Europe/Berlin"
+
+// The newUser function returns the profile of a user who doesn't have one yet, with the default settings.
+// Those users get plain text output until they register or turn embeds on.
+func newUser(id string) User {
+	return User{ID: strings.ToLower(id), Timezone: defaultTimezone, Units: "c"}
+}
+
+// The profile function returns the profile of a user, or the default one if the user doesn't have a profile yet.
+func profile(id string) (User, error) {
+	u, err := store.User(id)
+	if errors.Is(err, ErrNotFound) {
+		return newUser(id), nil
+	}
+	return u, err
+}
+
+// The updateProfile function changes the profile of a user with fn, creating the profile if the user has none.
+func updateProfile(id string, fn func(u *User)) error {
+	return store.UpdateUsers(func(users []User) ([]User, error) {
+		for i := range users {
+			if strings.EqualFold(users[i].ID, id) {
+				fn(&users[i])
+				return users, nil
+			}
+		}
+		u := newUser(id)
+		fn(&u)
+		return append(users, u), nil
+	})
+}
+
+// The mergeProfiles function moves the user settings older versions kept outside of the users file into it.
+// Those are the weather settings of the weather file and the time zones of the bet files of every guild, which
+// only create profiles for the users who don't have one. Each of those files is merged if it exists, on its own.
+// IDs are stored in lower case and repeated profiles are dropped. The weather file is then renamed to
+// weather.csv.migrated, so it is only merged once, while the bet files are still used and merged on every start,
+// which only changes the users file when someone on them has no profile yet.
+func mergeProfiles(cs *csvStore) (summary []string, err error) {
+	path := cs.files().Weather
+	var weather [][]string
+	if fileExists(path) {
+		weather, err = readCSV(path)
+		if err != nil {
+			return
+		}
+	}
+	var bettors [][]string
+	for _, partition := range cfg().partitions() {
+		bet := (&csvStore{guild: partition}).files().Bet
+		if !fileExists(bet) {
+			continue
+		}
+		rows, err := readCSV(bet)
+		if err != nil {
+			return nil, err
+		}
+		bettors = append(bettors, rows...)
+	}
+	var timezones int
+	err = cs.UpdateUsers(func(users []User) ([]User, error) {
+		var profiles []User
+		index := make(map[string]int)
+		changed := false
+		find := func(id string) *User {
+			id = strings.ToLower(strings.TrimSpace(id))
+			i, ok := index[id]
+			if !ok {
+				i = len(profiles)
+				index[id] = i
+				profiles = append(profiles, newUser(id))
+			}
+			return &profiles[i]
+		}
+		for _, u := range users {
+			if id := strings.ToLower(u.ID); id != u.ID {
+				u.ID = id
+				changed = true
+			}
+			if _, ok := index[u.ID]; ok {
+				changed = true
+				continue
+			}
+			index[u.ID] = len(profiles)
+			profiles = append(profiles, u)
+		}
+		for _, row := range bettors {
+			if id := strings.ToLower(strings.TrimSpace(field(row, 0))); id != "" {
+				if _, ok := index[id]; !ok && field(row, 1) != "" {
+					find(id).Timezone = field(row, 1)
+					timezones++
+				}
+			}
+		}
+		for _, row := range weather {
+			if field(row, 0) == "" {
+				continue
+			}
+			u := find(field(row, 0))
+			if units := strings.ToLower(field(row, 1)); units != "" {
+				u.Units = units
+			}
+			if location := field(row, 2); location != "" {
+				u.Location = location
+			}
+		}
+		if !changed && timezones == 0 && len(weather) == 0 {
+			return nil, ErrNoChange
+		}
+		return profiles, nil
+	})
+	if err != nil {
+		return
+	}
+	if timezones > 0 {
+		summary = append(summary, fmt.Sprintf("%d time zones of the bet files merged into %s", timezones, cs.files().Users))
+	}
+	if !fileExists(path) {
+		return
+	}
+	err = os.Rename(path, path+".migrated")
+	if err != nil {
+		return
+	}
+	summary = append(summary, fmt.Sprintf("%s: %d weather settings merged into %s", path, len(weather), cs.files().Users))
+	return
+}
@@ -0,0 +1,166 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	cooldownsMu sync.Mutex                   // Protects lastUses.
+	lastUses    = make(map[string]time.Time) // When each command was last used by each user and on each channel.
+	bucket      tokenBucket                  // Limits the messages sent by the bot (see RateLimitConfig).
+)
+
+// The commandCooldowns function returns the cooldowns of a command used by a user. They come from the configuration
+// or, for built-in commands, from the registry if they aren't configured. Bot admins are never slowed down.
+func commandCooldowns(name string, user string) (cooldowns CooldownConfig) {
+	config := cfg()
+	if contains(config.Admins, user) {
+		return
+	}
+	cooldowns, ok := config.Cooldowns[name]
+	if !ok {
+		if spec, builtin := lookupCommand(name); builtin {
+			cooldowns.User = spec.Cooldown
+		}
+	}
+	return
+}
+
+// The cooldownWait function checks if a command can be used by a user on a channel, given its cooldowns.
+// It returns how long the caller must still wait, or zero if the command can be used. The use itself is only
+// recorded by cooldownRecord, once the command actually runs.
+func cooldownWait(name string, user string, channel string) time.Duration {
+	cooldowns := commandCooldowns(name, user)
+	if cooldowns.User == 0 && cooldowns.Channel == 0 {
+		return 0
+	}
+	cooldownsMu.Lock()
+	defer cooldownsMu.Unlock()
+	now := time.Now()
+	wait := cooldowns.User - now.Sub(lastUses[name+" user "+user])
+	if channelWait := cooldowns.Channel - now.Sub(lastUses[name+" channel "+channel]); channelWait > wait {
+		wait = channelWait
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// The cooldownRecord function records the use of a command by a user on a channel, which starts its cooldowns.
+// Commands that are denied or get invalid arguments aren't recorded, so that a typo doesn't slow the user down.
+func cooldownRecord(name string, user string, channel string) {
+	cooldowns := commandCooldowns(name, user)
+	if cooldowns.User == 0 && cooldowns.Channel == 0 {
+		return
+	}
+	cooldownsMu.Lock()
+	defer cooldownsMu.Unlock()
+	now := time.Now()
+	// Uses older than any cooldown can't slow anyone down anymore, so they are dropped once in a while.
+	if len(lastUses) > 1000 {
+		for key, last := range lastUses {
+			if now.Sub(last) > 24*time.Hour {
+				delete(lastUses, key)
+			}
+		}
+	}
+	if cooldowns.User > 0 {
+		lastUses[name+" user "+user] = now
+	}
+	if cooldowns.Channel > 0 {
+		lastUses[name+" channel "+channel] = now
+	}
+}
+
+// Small utility function that returns the message shown to someone who must wait before using a command again.
+func cooldownMessage(guild string, user string, wait time.Duration) string {
+	return userTemplates(guild, user).Text("cooldown", vars{"Seconds": int(math.Ceil(wait.Seconds()))})
+}
+
+// Type that represents a token bucket, which lets a burst of messages through and then one at a steady rate.
+// It holds up to the configured number of messages, each sent message takes one and they come back over the
+// configured period. When the bucket is empty, senders wait until there's a message available.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// The wait method blocks until a message can be sent according to the rate limit of the configuration.
+func (b *tokenBucket) wait() {
+	for {
+		limit := cfg().RateLimit
+		if limit.Messages <= 0 {
+			return
+		}
+		capacity := float64(limit.Messages)
+		rate := capacity / limit.Period.Seconds()
+		b.mu.Lock()
+		now := time.Now()
+		if b.last.IsZero() {
+			b.tokens = capacity
+		} else {
+			b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		delay := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+// Type that represents an HTTP transport that applies the rate limit to the messages the bot sends to channels,
+// including the replies to interactions sent or edited through their webhooks. It is used by the Discord session,
+// so that every message is limited no matter which part of the bot sends it.
+type limitedTransport struct {
+	base http.RoundTripper
+}
+
+// The RoundTrip method waits for the rate limit before sending a new message and then does the actual request.
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if limitedRequest(req) {
+		bucket.wait()
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Small utility function that checks if a request sends a message, either to a channel or as the followup of an
+// interaction, or edits one through the webhook of an interaction, which are the requests the rate limit applies to.
+func limitedRequest(req *http.Request) bool {
+	path := req.URL.Path
+	switch req.Method {
+	case http.MethodPost:
+		return strings.HasSuffix(path, "/messages") || strings.Contains(path, "/webhooks/")
+	case http.MethodPatch:
+		return strings.Contains(path, "/webhooks/")
+	}
+	return false
+}
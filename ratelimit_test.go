@@ -0,0 +1,72 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCooldown(t *testing.T) {
+	c := defaultConfig()
+	c.Admins = []string{"admin"}
+	c.Cooldowns = map[string]CooldownConfig{"weather": {User: time.Minute}}
+	conf.Store(c)
+	if wait := cooldownWait("weather", "user", "channel"); wait != 0 {
+		t.Fatalf("cooldownWait before any use = %v", wait)
+	}
+	// Checking doesn't start the cooldown, only recording does.
+	if wait := cooldownWait("weather", "user", "channel"); wait != 0 {
+		t.Fatalf("cooldownWait after a check = %v", wait)
+	}
+	cooldownRecord("weather", "user", "channel")
+	if wait := cooldownWait("weather", "user", "channel"); wait <= 0 || wait > time.Minute {
+		t.Errorf("cooldownWait after a use = %v", wait)
+	}
+	if wait := cooldownWait("weather", "other", "channel"); wait != 0 {
+		t.Errorf("cooldownWait of another user = %v", wait)
+	}
+	cooldownRecord("weather", "admin", "channel")
+	if wait := cooldownWait("weather", "admin", "channel"); wait != 0 {
+		t.Errorf("cooldownWait of an admin = %v", wait)
+	}
+}
+
+func TestLimitedRequest(t *testing.T) {
+	tests := []struct {
+		method  string
+		path    string
+		limited bool
+	}{
+		{http.MethodPost, "/api/v9/channels/1/messages", true},
+		{http.MethodPost, "/api/v9/webhooks/2/token", true},
+		{http.MethodPatch, "/api/v9/webhooks/2/token/messages/@original", true},
+		{http.MethodPatch, "/api/v9/channels/1/messages/3", false},
+		{http.MethodPost, "/api/v9/interactions/4/token/callback", false},
+		{http.MethodGet, "/api/v9/webhooks/2/token/messages/3", false},
+		{http.MethodDelete, "/api/v9/webhooks/2/token/messages/3", false},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "https://discord.com"+test.path, nil)
+		if got := limitedRequest(req); got != test.limited {
+			t.Errorf("limitedRequest(%s %s) = %v, want %v", test.method, test.path, got, test.limited)
+		}
+	}
+}
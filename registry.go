@@ -0,0 +1,316 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Type that represents a built-in command of the bot, declared once on the registry (see commands.go).
+// Everything else is derived from it: the prefix command dispatch, the slash command definition registered on
+// Discord, the handling of its interactions and the help text.
+type CommandSpec struct {
+	Name        string                                // Name of the command, used both as prefix and slash command.
+	Aliases     []string                              // Other names the command can be called by as a prefix command.
+	Description string                                // Short description shown on the help and on Discord.
+	Usage       string                                // Arguments of the command shown on the help, after its name.
+	Options     []*discordgo.ApplicationCommandOption // Options of the slash command, in the order of the arguments.
+	Permission  int64                                 // Discord permissions needed to run the command, 0 for everyone.
+	AdminOnly   bool                                  // Whether only the bot admins (see Config) can run the command.
+	Cooldown    time.Duration                         // Time each user must wait between uses, unless configured.
+	Ephemeral   bool                                  // Whether slash command replies are only shown to the caller.
+	Complete    map[string]completer                  // Suggestions for options of the slash command, by option name.
+	Handler     func(s *discordgo.Session, c Command) *DiscordOutput
+}
+
+// The lookupCommand function returns the command of the registry with the given name or alias.
+func lookupCommand(name string) (*CommandSpec, bool) {
+	for _, spec := range registry {
+		if strings.EqualFold(spec.Name, name) || contains(spec.Aliases, strings.ToLower(name)) {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+// The slashCommands function returns the definition of the slash commands of every command of the registry.
+func slashCommands() []*discordgo.ApplicationCommand {
+	definitions := make([]*discordgo.ApplicationCommand, 0, len(registry))
+	for _, spec := range registry {
+		// Options of types Discord doesn't know about are registered as strings.
+		// Options with suggestions are registered with autocomplete, so Discord asks for them while typing.
+		options := make([]*discordgo.ApplicationCommandOption, 0, len(spec.Options))
+		for _, option := range spec.Options {
+			if option.Type == optionDuration || spec.Complete[option.Name] != nil {
+				registered := *option
+				if registered.Type == optionDuration {
+					registered.Type = discordgo.ApplicationCommandOptionString
+				}
+				registered.Autocomplete = spec.Complete[option.Name] != nil
+				option = &registered
+			}
+			options = append(options, option)
+		}
+		// Commands that need some permissions are hidden by Discord from members who don't have them.
+		// Server admins can still change who sees them on the integration settings, but the bot always checks.
+		var permissions *int64
+		if spec.Permission != 0 {
+			permission := spec.Permission
+			permissions = &permission
+		}
+		definitions = append(definitions, &discordgo.ApplicationCommand{
+			Name:                     spec.Name,
+			Description:              spec.Description,
+			Options:                  options,
+			DefaultMemberPermissions: permissions,
+		})
+	}
+	return definitions
+}
+
+// The usageText method returns the usage message of a command as shown on the help, in the language of the templates.
+// Languages can translate the description of the command with a help.command.<name> template.
+func (spec *CommandSpec) usageText(tpl *Templates, prefix string) string {
+	text := prefix + spec.Name
+	if spec.Usage != "" {
+		text += " " + spec.Usage
+	}
+	description := spec.Description
+	if tpl.Has("help.command." + spec.Name) {
+		description = tpl.Text("help.command."+spec.Name, nil)
+	}
+	text += "\n\n" + description
+	if len(spec.Aliases) > 0 {
+		aliases := prefix + strings.Join(spec.Aliases, ", "+prefix)
+		text += "\n\n" + tpl.Text("help.aliases", vars{"Aliases": aliases})
+	}
+	return text
+}
+
+// Names of the Discord permissions used by commands, shown when someone is denied access to one.
+var permissionNames = map[int64]string{
+	discordgo.PermissionAdministrator:  "Administrator",
+	discordgo.PermissionBanMembers:     "Ban Members",
+	discordgo.PermissionKickMembers:    "Kick Members",
+	discordgo.PermissionManageChannels: "Manage Channels",
+	discordgo.PermissionManageMessages: "Manage Messages",
+	discordgo.PermissionManageRoles:    "Manage Roles",
+	discordgo.PermissionManageServer:   "Manage Server",
+}
+
+// Small utility function that checks if a user has the Administrator permission on the channel of a command.
+func serverAdmin(s *discordgo.Session, c Command) bool {
+	perms, err := s.UserChannelPermissions(c.User, c.Channel)
+	if err != nil {
+		log.Println("access:", err)
+		return false
+	}
+	return perms&discordgo.PermissionAdministrator != 0
+}
+
+// The access method checks if a user can run a command and returns why not, or an empty string if they can.
+// Bot admins can run every command and commands marked AdminOnly can't be run by anyone else, unless there are no
+// bot admins, in which case the users with the Administrator permission stand in for them. Everyone else
+// needs the Discord permissions of the command, resolved on the channel so that channel overwrites are taken into
+// account, and one of the roles the configuration of the guild requires for the command, if there are any.
+func (spec *CommandSpec) access(s *discordgo.Session, c Command) string {
+	config := cfg()
+	if contains(config.Admins, c.User) {
+		return ""
+	}
+	tpl := userTemplates(c.Guild, c.User)
+	if spec.AdminOnly && !(len(config.Admins) == 0 && serverAdmin(s, c)) {
+		return tpl.Text("access.admins", nil)
+	}
+	if spec.Permission != 0 {
+		perms, err := s.UserChannelPermissions(c.User, c.Channel)
+		if err != nil || perms&spec.Permission != spec.Permission {
+			if err != nil {
+				log.Println("access:", err)
+			}
+			var names []string
+			for permission, name := range permissionNames {
+				if spec.Permission&permission != 0 {
+					names = append(names, name)
+				}
+			}
+			if len(names) == 0 {
+				return tpl.Text("access.permissions", nil)
+			}
+			sort.Strings(names)
+			return tpl.Text("access.permission", vars{"Permissions": names})
+		}
+	}
+	roles := config.guild(c.Guild).Roles[spec.Name]
+	if len(roles) > 0 {
+		ok, err := hasRole(s, c.Guild, c.User, roles)
+		if err != nil {
+			log.Println("access:", err)
+		}
+		if !ok {
+			return tpl.Text("access.roles", vars{"Roles": roles})
+		}
+	}
+	return ""
+}
+
+// The hasRole function checks if a member of a guild has any of the given roles, which can be names or IDs.
+func hasRole(s *discordgo.Session, guild string, user string, roles []string) (bool, error) {
+	if guild == "" {
+		return false, nil
+	}
+	member, err := s.State.Member(guild, user)
+	if err != nil {
+		member, err = s.GuildMember(guild, user)
+		if err != nil {
+			return false, err
+		}
+	}
+	guildRoles, err := s.GuildRoles(guild)
+	if err != nil {
+		return false, err
+	}
+	names := make(map[string]string)
+	for _, role := range guildRoles {
+		names[role.ID] = role.Name
+	}
+	for _, id := range member.Roles {
+		for _, role := range roles {
+			if role == id || strings.EqualFold(role, names[id]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// The run method runs a command after checking that the caller is allowed to do it and parsing its arguments.
+// If the arguments don't match the options of the command, the usage of the command is shown instead. Only the
+// commands that actually run are recorded for their cooldowns.
+func (spec *CommandSpec) run(s *discordgo.Session, c Command) *DiscordOutput {
+	tpl := userTemplates(c.Guild, c.User)
+	do := NewDiscordOutput(s, colorError, tpl.Text(spec.Name+".title", nil), "")
+	do.Embeds, _ = embedsEnabled(c.User)
+	if reason := spec.access(s, c); reason != "" {
+		do.Description = tpl.Text("access.denied", vars{"Reason": reason})
+		return do
+	}
+	err := spec.bind(&c)
+	if err != nil {
+		prefix := cfg().guild(c.Guild).Prefix
+		do.Description = tpl.Text("invalid_usage", vars{"Error": err, "Prefix": prefix, "Command": spec.Name, "Usage": spec.Usage})
+		return do
+	}
+	cooldownRecord(spec.Name, c.User, c.Channel)
+	return spec.Handler(s, c)
+}
+
+// The interactionCommand function converts a slash command interaction into the Command its handler expects.
+// Each option becomes a name=value argument, which bind then parses like the arguments of a prefix command.
+func interactionCommand(spec *CommandSpec, i *discordgo.InteractionCreate) (command Command) {
+	command.Name = spec.Name
+	command.Channel = i.ChannelID
+	command.Guild = i.GuildID
+	command.User = interactionUser(i)
+	for _, option := range i.ApplicationCommandData().Options {
+		value := fmt.Sprint(option.Value)
+		// Numbers arrive as float64, which would otherwise be formatted with an exponent when they are big.
+		if n, ok := option.Value.(float64); ok {
+			value = strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		command.Args = append(command.Args, option.Name+"="+value)
+	}
+	return
+}
+
+// Small utility function that returns the ID of the user who triggered an interaction, on a server or on a DM.
+func interactionUser(i *discordgo.InteractionCreate) string {
+	if i.Member != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// The respondText function replies to an interaction with a short text only the caller sees.
+func respondText(s *discordgo.Session, i *discordgo.InteractionCreate, text string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: text, Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Println("respondText:", err)
+	}
+}
+
+// The showModal function replies to an interaction with a modal (a form), made of a text input per row.
+// Its submission is handled by the component router like buttons, using the first part of the custom ID.
+func showModal(s *discordgo.Session, i *discordgo.InteractionCreate, customID string, title string, inputs ...discordgo.TextInput) {
+	rows := make([]discordgo.MessageComponent, 0, len(inputs))
+	for _, input := range inputs {
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{input}})
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{CustomID: customID, Title: title, Components: rows},
+	})
+	if err != nil {
+		log.Println("showModal:", err)
+	}
+}
+
+// The modalValues function returns the values of the text inputs of a submitted modal, by their custom ID.
+func modalValues(i *discordgo.InteractionCreate) map[string]string {
+	values := make(map[string]string)
+	for _, row := range i.ModalSubmitData().Components {
+		if row, ok := row.(*discordgo.ActionsRow); ok {
+			for _, component := range row.Components {
+				if input, ok := component.(*discordgo.TextInput); ok {
+					values[input.CustomID] = input.Value
+				}
+			}
+		}
+	}
+	return values
+}
+
+// The respond function runs a command for an interaction and replies with its output, or with a short
+// acknowledgement if the output is nil. The reply is created before running the command, so that it can be deferred
+// if the command takes long.
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, ephemeral bool, command func() *DiscordOutput) {
+	r := interactionReply(s, i.Interaction, interactionUser(i), ephemeral)
+	defer r.Close()
+	do := command()
+	if do == nil {
+		return
+	}
+	_, err := r.Send(do)
+	if err != nil {
+		log.Println("respond:", err)
+	}
+}
@@ -0,0 +1,259 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	configPath   = configFile              // Full path to the config file actually used, set by main.
+	reloadMu     sync.Mutex                // Serializes reloads triggered by signals, file changes and commands.
+	commandsMu   sync.Mutex                // Protects commandsHash.
+	commandsHash = make(map[string]string) // Signature of the slash commands registered on each guild.
+	reloadHooks  []func(path string)       // Functions called when a data file changes on disk.
+	hooksMu      sync.Mutex                // Protects reloadHooks.
+	watchPeriod  = 5 * time.Second         // How often the config and data files are checked for changes.
+)
+
+// The onDataChange function registers a function to be called with the path of any data file that changes on disk.
+// Commands read their data files on every call, so this is only needed by code that keeps data cached in memory.
+func onDataChange(hook func(path string)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// The reloadConfig function reads the configuration file again and applies it to the running bot.
+// Most settings take effect immediately, since the rest of the bot always reads the current configuration.
+// The token, the storage settings and the calendar address are only used when the bot starts, so changes to them
+// are reported and kept for the next start. If the new configuration is invalid, the current one is kept and the problems are returned.
+func reloadConfig(s *discordgo.Session) (changes []string, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	old := cfg()
+	c, err := loadConfig(configPath)
+	if err != nil {
+		return
+	}
+	if c.Token != old.Token {
+		c.Token = old.Token
+		changes = append(changes, "Token changed, restart the bot to use it.")
+	}
+	if c.Storage != old.Storage {
+		c.Storage = old.Storage
+		changes = append(changes, "Storage settings changed, restart the bot to use them.")
+	}
+	if c.Calendar.Listen != old.Calendar.Listen {
+		c.Calendar.Listen = old.Calendar.Listen
+		changes = append(changes, "Calendar address changed, restart the bot to use it.")
+	}
+	if c.Calendar.URL != old.Calendar.URL {
+		changes = append(changes, "Calendar URL changed.")
+	}
+	if !reflect.DeepEqual(c.Reminders, old.Reminders) {
+		changes = append(changes, "Event reminders changed.")
+	}
+	if !reflect.DeepEqual(c.Categories, old.Categories) {
+		changes = append(changes, "Event categories changed.")
+	}
+	if c.Prefix != old.Prefix {
+		changes = append(changes, "Prefix changed to "+c.Prefix)
+	}
+	if c.Language != old.Language {
+		changes = append(changes, "Language changed to "+c.Language)
+	}
+	if c.FeedInterval != old.FeedInterval {
+		changes = append(changes, "Feed interval changed.")
+	}
+	if c.OWMAPIKey != old.OWMAPIKey {
+		changes = append(changes, "OWM API key changed.")
+	}
+	if !reflect.DeepEqual(c.Admins, old.Admins) {
+		changes = append(changes, "Bot admins changed.")
+	}
+	if c.RateLimit != old.RateLimit {
+		changes = append(changes, "Rate limit changed.")
+	}
+	if !reflect.DeepEqual(c.Cooldowns, old.Cooldowns) {
+		changes = append(changes, "Cooldowns changed.")
+	}
+	if c.Files != old.Files {
+		changes = append(changes, "File paths changed.")
+	}
+	if !reflect.DeepEqual(c.Guilds, old.Guilds) {
+		changes = append(changes, "Guild settings changed.")
+	}
+	conf.Store(c)
+	// Slash commands are registered per guild, so they must be registered on new guilds and removed from old ones.
+	current := make(map[string]bool)
+	for _, id := range c.guildIDs() {
+		current[id] = true
+		if !contains(old.guildIDs(), id) {
+			changes = append(changes, "Guild "+id+" added.")
+			err = syncCommands(s, id)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, id := range old.guildIDs() {
+		if !current[id] {
+			changes = append(changes, "Guild "+id+" removed.")
+			err = clearCommands(s, id)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// The commandsSignature function returns a string that only changes when the definition of the commands changes.
+// Only the fields we set on our definitions are considered, so the commands returned by Discord, which have some
+// extra fields like IDs and versions, have the same signature as our own definitions when they are up to date.
+func commandsSignature(cmds []*discordgo.ApplicationCommand) string {
+	type definition struct {
+		Name        string
+		Description string
+		Options     []*discordgo.ApplicationCommandOption
+		Permissions *int64
+	}
+	definitions := make([]definition, 0, len(cmds))
+	for _, c := range cmds {
+		definitions = append(definitions, definition{c.Name, c.Description, c.Options, c.DefaultMemberPermissions})
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	data, err := json.Marshal(definitions)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// The syncCommands function makes sure the slash commands registered on a guild match the commands of the registry.
+// They are only overwritten when their definitions differ, so restarting or reloading the bot doesn't delete and
+// re-create the commands every time, which would make them briefly disappear from the users' clients.
+func syncCommands(s *discordgo.Session, guildID string) error {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	commands := slashCommands()
+	signature := commandsSignature(commands)
+	if commandsHash[guildID] == signature {
+		return nil
+	}
+	remote, err := s.ApplicationCommands(s.State.User.ID, guildID)
+	if err == nil && commandsSignature(remote) == signature {
+		commandsHash[guildID] = signature
+		return nil
+	}
+	_, err = s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, commands)
+	if err != nil {
+		return err
+	}
+	log.Println("syncCommands: slash commands updated on guild", guildID)
+	commandsHash[guildID] = signature
+	return nil
+}
+
+// The clearCommands function removes all the slash commands of the bot from a guild.
+func clearCommands(s *discordgo.Session, guildID string) error {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, []*discordgo.ApplicationCommand{})
+	if err != nil {
+		return err
+	}
+	delete(commandsHash, guildID)
+	return nil
+}
+
+// The tskReload function runs in the background as a goroutine reloading the configuration when needed.
+// A reload happens when the process receives SIGHUP or when the modification time of the config file changes.
+// The data files are watched too, so that anything caching their contents can be told to read them again.
+func tskReload(dg *discordgo.Session) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	modTimes := make(map[string]time.Time)
+	// Small closure that returns whether a file changed since the last time it was checked.
+	// The first time a file is seen it is not considered changed, we only record its modification time.
+	changed := func(path string) bool {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false
+		}
+		last, seen := modTimes[path]
+		modTimes[path] = info.ModTime()
+		return seen && !info.ModTime().Equal(last)
+	}
+	ticker := time.NewTicker(watchPeriod)
+	defer ticker.Stop()
+	for {
+		reload := false
+		select {
+		case <-hup:
+			log.Println("tskReload: SIGHUP received")
+			reload = true
+		case <-ticker.C:
+			reload = changed(configPath)
+			c := cfg()
+			for _, partition := range c.partitions() {
+				files := c.files(partition)
+				paths := []string{files.Alias, files.Answers, files.Bet, files.Bets, files.Disabled, files.Drivers,
+					files.Events, files.Feeds, files.Quotes, files.Results, files.Roles, files.Stats, files.Templates, files.Usage,
+					files.Users}
+				// The templates of other languages live next to the templates file (see Templates).
+				for _, lang := range languages(c) {
+					paths = append(paths, localizedPath(files.Templates, lang))
+				}
+				for _, path := range paths {
+					if changed(path) {
+						hooksMu.Lock()
+						hooks := reloadHooks
+						hooksMu.Unlock()
+						for _, hook := range hooks {
+							hook(path)
+						}
+					}
+				}
+			}
+		}
+		if !reload {
+			continue
+		}
+		changes, err := reloadConfig(dg)
+		if err != nil {
+			log.Println("tskReload: configuration not reloaded:", err)
+			continue
+		}
+		for _, change := range changes {
+			log.Println("tskReload:", change)
+		}
+	}
+}
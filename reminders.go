@@ -0,0 +1,197 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	reminderGrace = 5 * time.Minute  // Events that started this long ago still get their reminders, if they were missed.
+	reminderKeep  = 24 * time.Hour   // How long after the start of an event its sent reminders are kept.
+	reminderMax   = 10 * time.Minute // Longest tskEvents sleeps, so that changes to the configuration are picked up.
+)
+
+// Go channel used to wake tskEvents up when the events change, so that it works out its next reminder again.
+var eventsWake = make(chan struct{}, 1)
+
+// The wakeEvents function wakes tskEvents up, unless it was already told to.
+func wakeEvents() {
+	select {
+	case eventsWake <- struct{}{}:
+	default:
+	}
+}
+
+// The reminderOffsets function returns how long before their start the events of a category are announced on a
+// partition (see partition), from the earliest reminder to the latest. Categories without reminders of their own
+// use the reminders of the configuration.
+func reminderOffsets(partition string, category string) (offsets []time.Duration) {
+	guild := partition
+	if guild == "" {
+		guild = cfg().Guild
+	}
+	reminders := cfg().Reminders
+	if c, ok := cfg().guild(guild).Categories[category]; ok && c.Reminders != nil {
+		reminders = c.Reminders
+	}
+	for _, before := range reminders {
+		if !containsDuration(offsets, before) {
+			offsets = append(offsets, before)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return
+}
+
+// Small utility function that checks if a slice of durations contains a given duration.
+func containsDuration(durations []time.Duration, d time.Duration) bool {
+	for _, other := range durations {
+		if other == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Small utility function that checks if a reminder of an event was already sent.
+func reminderSent(sent []SentReminder, e Event, before time.Duration) bool {
+	for _, r := range sent {
+		if r.Before == before && r.Time.Equal(e.Time) && strings.EqualFold(r.Category, e.Category) &&
+			strings.EqualFold(r.Name, e.Name) && strings.EqualFold(r.Session, e.Session) {
+			return true
+		}
+	}
+	return false
+}
+
+// The remindEvents function announces the events of a partition whose reminders are due, and returns when the next
+// reminder is due (a zero time if there is none). When several reminders of an event are due at once, because the
+// bot was down or the event was added late, only the latest one is sent. On startup, the events that already
+// started get their reminders saved as sent without announcing them, as they may have been announced before the
+// bot went down. The reminders are saved as sent before they are announced, so that they are never sent twice,
+// even if the bot stops halfway.
+func remindEvents(dg *discordgo.Session, partition string, now time.Time, startup bool) (next time.Time, err error) {
+	st := store.Guild(partition)
+	index, err := guildEvents(partition)
+	if err != nil {
+		return
+	}
+	sent, err := st.Reminders()
+	if err != nil {
+		return
+	}
+	var due []Event
+	var done []SentReminder
+	changed := false
+	for _, e := range index.Between(now.Add(-reminderGrace), time.Time{}) {
+		announce := false
+		started := startup && !e.Time.After(now)
+		for _, before := range reminderOffsets(partition, e.Category) {
+			if reminderSent(sent, e, before) {
+				continue
+			}
+			at := e.Time.Add(-before)
+			if at.After(now) {
+				if next.IsZero() || at.Before(next) {
+					next = at
+				}
+				continue
+			}
+			// The earlier reminders due are saved as sent too, but only the latest one is announced.
+			done = append(done, SentReminder{Category: e.Category, Name: e.Name, Session: e.Session, Time: e.Time, Before: before})
+			changed = true
+			announce = !started
+		}
+		if announce {
+			due = append(due, e)
+		}
+	}
+	if !changed {
+		return
+	}
+	err = st.UpdateReminders(func(reminders []SentReminder) ([]SentReminder, error) {
+		kept := reminders[:0]
+		for _, r := range reminders {
+			if now.Sub(r.Time) < reminderKeep {
+				kept = append(kept, r)
+			}
+		}
+		return append(kept, done...), nil
+	})
+	if err != nil {
+		return
+	}
+	for _, e := range due {
+		announceEvent(dg, partition, e, now)
+	}
+	return
+}
+
+// The announceEvent function announces an event on its channel or, if it has none, on the events channel of the
+// guild, saying how long until it starts.
+func announceEvent(dg *discordgo.Session, partition string, event Event, now time.Time) {
+	mention := ""
+	image := ""
+	tpl := guildTemplates(partition)
+	left := event.Time.Sub(now).Round(time.Minute)
+	data := vars{"Event": event, "Started": left <= 0, "Hours": int(left.Hours()), "Minutes": int(left.Minutes()) % 60}
+	do := NewDiscordOutput(dg, colorError, tpl.Text("announce.title", data), "")
+	do.Embeds = true
+	// Events without a channel are announced on the events channel configured for the guild.
+	if event.Channel == "" {
+		if partition == "" {
+			event.Channel = cfg().guild(cfg().Guild).EventsChannel
+		} else {
+			event.Channel = cfg().guild(partition).EventsChannel
+		}
+	}
+	fields := []map[string]string{}
+	category := map[string]string{
+		"Name":  tpl.Text("event.category", nil),
+		"Value": event.Category,
+	}
+	description := map[string]string{
+		"Name":  tpl.Text("event.event", nil),
+		"Value": tpl.Text("event.event_value", vars{"Event": event}),
+	}
+	fields = append(fields, category, description)
+	if event.Image != "" {
+		image = event.Image
+	}
+	if event.Mention != "" {
+		roles := map[string]string{
+			"Name":  tpl.Text("announce.roles", nil),
+			"Value": event.Mention,
+		}
+		fields = append(fields, roles)
+		mention = event.Mention + " "
+	}
+	if _, err := dg.ChannelMessageSend(event.Channel, mention+tpl.Text("announce.text", data)); err != nil {
+		log.Println("announceEvent:", err)
+	}
+	do.Fields = &fields
+	do.Image = &image
+	do.Send(partition, event.Channel)
+}
@@ -0,0 +1,211 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// States of a reply to an interaction, which decide how the next output is sent.
+const (
+	replyPending  = iota // Nothing was sent yet, so the interaction is replied to directly.
+	replyDeferred        // Discord was told the reply is coming, so the deferred reply is edited.
+	replySent            // The reply was sent, so anything else is sent as a followup message.
+)
+
+var (
+	interactionDeadline = 2 * time.Second // How long a command can take before its interaction reply is deferred.
+	slowCommand         = 3 * time.Second // How long a prefix command can take before the user is told to wait.
+)
+
+// Type that represents where the output of a command goes, either a channel (prefix commands) or the reply to an
+// interaction (slash commands, components and modals). Commands write to it without knowing which one it is.
+// Discord fails interactions that aren't replied to within 3 seconds, so when a command takes longer its reply is
+// deferred and the output edited into it once ready. Replies are safe to use from several goroutines.
+type Reply struct {
+	Session     *discordgo.Session
+	Guild       string // Guild whose templates are used for the output, empty for DMs.
+	User        string // User the templates are localized for (see userTemplates).
+	Channel     string
+	Interaction *discordgo.Interaction // Interaction being replied to, or nil for a channel.
+	Ephemeral   bool                   // Whether the reply to an interaction is only shown to the caller.
+	mu          sync.Mutex
+	state       int
+	timer       *time.Timer
+}
+
+// The channelReply function returns the reply of a prefix command called by a user on a channel of a guild.
+// If the command takes long to run, the user is told to wait.
+func channelReply(s *discordgo.Session, guild string, channel string, user string) *Reply {
+	r := &Reply{Session: s, Guild: guild, User: user, Channel: channel}
+	r.timer = time.AfterFunc(slowCommand, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.state == replyPending {
+			s.ChannelMessageSend(channel, userTemplates(guild, user).Text("slow_command", nil))
+		}
+	})
+	return r
+}
+
+// The interactionReply function returns the reply to an interaction of a user, which is deferred if the command
+// takes long.
+func interactionReply(s *discordgo.Session, i *discordgo.Interaction, user string, ephemeral bool) *Reply {
+	r := &Reply{Session: s, Guild: i.GuildID, User: user, Channel: i.ChannelID, Interaction: i, Ephemeral: ephemeral}
+	r.timer = time.AfterFunc(interactionDeadline, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.state != replyPending {
+			return
+		}
+		err := s.InteractionRespond(i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: r.flags()},
+		})
+		if err != nil {
+			log.Println("interactionReply:", err)
+			return
+		}
+		r.state = replyDeferred
+	})
+	return r
+}
+
+// The Send method sends an output, one message per page or as a paginated message, and returns the first message.
+// The files of the output are attached to the first message.
+func (r *Reply) Send(do *DiscordOutput) (first *discordgo.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stop()
+	tpl := userTemplates(r.Guild, r.User)
+	pages := do.Pages(tpl.Theme())
+	if do.Paginate && len(pages) > 1 {
+		message := pages[0].message(pageButtons(tpl, 0, len(pages)))
+		message.Files = do.Files
+		var interaction *discordgo.Interaction
+		if r.Interaction != nil && r.state != replySent {
+			interaction = r.Interaction
+		}
+		first, err = r.send(message)
+		if err != nil {
+			return
+		}
+		paginate(r.Session, first, interaction, pages, tpl)
+	} else {
+		for i, page := range pages {
+			message := page.message(nil)
+			if i == 0 {
+				message.Files = do.Files
+			}
+			m, err := r.send(message)
+			if err != nil {
+				return first, err
+			}
+			if i == 0 {
+				first = m
+			}
+		}
+	}
+	if do.OnSend != nil && first != nil {
+		do.OnSend(first)
+	}
+	return
+}
+
+// The send method sends a single message to the channel, or as the reply to the interaction or a followup of it.
+func (r *Reply) send(message *discordgo.MessageSend) (m *discordgo.Message, err error) {
+	if r.Interaction == nil {
+		m, err = r.Session.ChannelMessageSendComplex(r.Channel, message)
+		if err == nil {
+			r.state = replySent
+		}
+		return
+	}
+	switch r.state {
+	case replyPending:
+		err = r.Session.InteractionRespond(r.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:    message.Content,
+				Embeds:     message.Embeds,
+				Components: message.Components,
+				Files:      message.Files,
+				Flags:      r.flags(),
+			},
+		})
+		if err != nil {
+			return
+		}
+		r.state = replySent
+		return r.Session.InteractionResponse(r.Interaction)
+	case replyDeferred:
+		m, err = r.Session.InteractionResponseEdit(r.Interaction, &discordgo.WebhookEdit{
+			Content:    &message.Content,
+			Embeds:     &message.Embeds,
+			Components: &message.Components,
+			Files:      message.Files,
+		})
+		if err == nil {
+			r.state = replySent
+		}
+		return
+	}
+	return r.Session.FollowupMessageCreate(r.Interaction, true, &discordgo.WebhookParams{
+		Content:    message.Content,
+		Embeds:     message.Embeds,
+		Components: message.Components,
+		Files:      message.Files,
+		Flags:      r.flags(),
+	})
+}
+
+// The Close method finishes the reply once the command is done.
+// Interactions must always be replied to, so if the command sent nothing the caller is told it's done.
+func (r *Reply) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stop()
+	if r.Interaction == nil || r.state == replySent {
+		return
+	}
+	r.Ephemeral = true
+	_, err := r.send(&discordgo.MessageSend{Content: userTemplates(r.Guild, r.User).Text("done", nil)})
+	if err != nil {
+		log.Println("Close:", err)
+	}
+}
+
+// The stop method stops the timer that defers the reply or tells the user to wait, if there is one.
+func (r *Reply) stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
+
+// The flags method returns the flags of the messages sent as the reply to an interaction.
+func (r *Reply) flags() discordgo.MessageFlags {
+	if r.Ephemeral {
+		return discordgo.MessageFlagsEphemeral
+	}
+	return 0
+}
@@ -0,0 +1,669 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Schema migrations of the SQL backend. Each entry upgrades the schema by one version and is applied only once.
+// The version of the schema of a database is the number of migrations already applied to it.
+// Never change an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE users (
+		id INTEGER PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT '',
+		embeds INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX users_user_id ON users (user_id COLLATE NOCASE);
+	CREATE TABLE bettors (
+		id INTEGER PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT '',
+		points INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE bets (
+		id INTEGER PRIMARY KEY,
+		race TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		first TEXT NOT NULL DEFAULT '',
+		second TEXT NOT NULL DEFAULT '',
+		third TEXT NOT NULL DEFAULT '',
+		points INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX bets_race_user_id ON bets (race COLLATE NOCASE, user_id COLLATE NOCASE);
+	CREATE TABLE events (
+		id INTEGER PRIMARY KEY,
+		category TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		session TEXT NOT NULL DEFAULT '',
+		start TEXT NOT NULL,
+		channel TEXT NOT NULL DEFAULT '',
+		image TEXT NOT NULL DEFAULT '',
+		mention TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX events_start ON events (start);
+	CREATE TABLE feeds (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		channel TEXT NOT NULL DEFAULT '',
+		last TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE quotes (
+		id INTEGER PRIMARY KEY,
+		date TEXT NOT NULL DEFAULT '',
+		text TEXT NOT NULL,
+		channel TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX quotes_channel ON quotes (channel COLLATE NOCASE);
+	CREATE TABLE weather (
+		id INTEGER PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		units TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX weather_user_id ON weather (user_id COLLATE NOCASE);
+	CREATE TABLE stats (
+		id INTEGER PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		messages INTEGER NOT NULL DEFAULT 0
+	);`,
+	`ALTER TABLE bettors ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE bets ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE events ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE feeds ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE quotes ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE stats ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX bettors_guild_id ON bettors (guild_id);
+	CREATE INDEX bets_guild_id ON bets (guild_id);
+	CREATE INDEX events_guild_id ON events (guild_id);
+	CREATE INDEX feeds_guild_id ON feeds (guild_id);
+	CREATE INDEX quotes_guild_id ON quotes (guild_id);
+	CREATE INDEX stats_guild_id ON stats (guild_id);`,
+	`ALTER TABLE users ADD COLUMN language TEXT NOT NULL DEFAULT '';`,
+	// The weather settings and the time zones of the bettors are merged into the profiles of the users.
+	// Bettors with a time zone and weather settings without a profile get one, as the users file does (see mergeProfiles).
+	`ALTER TABLE users ADD COLUMN units TEXT NOT NULL DEFAULT 'c';
+	ALTER TABLE users ADD COLUMN location TEXT NOT NULL DEFAULT '';
+	INSERT INTO users (user_id, timezone)
+		SELECT LOWER(user_id), MAX(timezone) FROM bettors
+		WHERE timezone != '' AND NOT EXISTS (SELECT 1 FROM users WHERE users.user_id = bettors.user_id COLLATE NOCASE)
+		GROUP BY LOWER(user_id);
+	INSERT INTO users (user_id, timezone)
+		SELECT LOWER(user_id), 'Europe/Berlin' FROM weather
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.user_id = weather.user_id COLLATE NOCASE)
+		GROUP BY LOWER(user_id);
+	UPDATE users SET
+		units = COALESCE((SELECT LOWER(units) FROM weather WHERE weather.user_id = users.user_id COLLATE NOCASE AND units != '' ORDER BY id DESC LIMIT 1), units),
+		location = COALESCE((SELECT location FROM weather WHERE weather.user_id = users.user_id COLLATE NOCASE AND location != '' ORDER BY id DESC LIMIT 1), location);
+	UPDATE bettors SET timezone = '';
+	DROP TABLE weather;`,
+	`CREATE TABLE reminders (
+		id INTEGER PRIMARY KEY,
+		category TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		session TEXT NOT NULL DEFAULT '',
+		start TEXT NOT NULL,
+		before_start INTEGER NOT NULL DEFAULT 0,
+		guild_id TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX reminders_guild_id ON reminders (guild_id);`,
+}
+
+// Type that implements the Store interface on top of an embedded SQLite database (pure Go, no cgo).
+// Only the data written by the bot lives in the database. The files edited by hand (roles, drivers, aliases,
+// answers, usage, disabled commands and results) are still read from their CSV files through files. The disabled
+// commands are also managed with the enable and disable commands now, but they stay on their file for older setups.
+// The database uses a single connection, so every statement and transaction is serialized.
+// Tables holding server data have a guild_id column with the partition each row belongs to (see Config.partition).
+type sqlStore struct {
+	db    *sql.DB
+	files *csvStore
+	guild string
+}
+
+// Interface satisfied by both *sql.DB and *sql.Tx, so that loading functions work inside and outside transactions.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// The NewSQLStore function opens (or creates) the database at path and upgrades its schema if needed.
+func NewSQLStore(path string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	ss := &sqlStore{db: db, files: NewCSVStore().(*csvStore)}
+	err = ss.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ss, nil
+}
+
+// The migrate method applies any schema migration newer than the current version of the database.
+func (ss *sqlStore) migrate() error {
+	_, err := ss.db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)")
+	if err != nil {
+		return err
+	}
+	var version int
+	err = ss.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := ss.db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(migrations[i])
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO schema_version (version) VALUES (?)", i+1)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying schema migration %d: %w", i+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Small utility function that runs a query and converts each resulting row to a record using scan.
+func queryRecords[T any](q queryer, scan func(rows *sql.Rows) (T, error), query string, args ...interface{}) (records []T, err error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	err = rows.Err()
+	return
+}
+
+// Small utility function that replaces rows of a table with the given records inside a transaction.
+// The rows removed are the ones matched by the del statement and its arguments, usually a whole table or partition.
+// The insert statement must have one placeholder per value returned by values.
+func replaceRecords[T any](tx *sql.Tx, del string, insert string, records []T, values func(record T) []interface{}, delArgs ...interface{}) error {
+	_, err := tx.Exec(del, delArgs...)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range records {
+		_, err = stmt.Exec(values(record)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Small utility function that runs a function inside a transaction, committing only if it succeeds.
+func (ss *sqlStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, ErrNoChange) {
+			return nil
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// Small utility function that implements the Update methods: load all records, apply fn and save them back,
+// all within a single transaction. Because the database has a single connection, fn must not use the store.
+func updateRecords[T any](ss *sqlStore, load func(q queryer) ([]T, error), save func(tx *sql.Tx, records []T) error, fn func(records []T) ([]T, error)) error {
+	return ss.inTx(func(tx *sql.Tx) error {
+		records, err := load(tx)
+		if err != nil {
+			return err
+		}
+		records, err = fn(records)
+		if err != nil {
+			return err
+		}
+		return save(tx, records)
+	})
+}
+
+// Loading and saving functions for each kind of record stored on the database.
+
+func scanUser(rows *sql.Rows) (u User, err error) {
+	err = rows.Scan(&u.ID, &u.Timezone, &u.Embeds, &u.Language, &u.Units, &u.Location)
+	return
+}
+
+func loadUsers(q queryer) ([]User, error) {
+	return queryRecords(q, scanUser, "SELECT user_id, timezone, embeds, language, units, location FROM users ORDER BY id")
+}
+
+func saveUsers(tx *sql.Tx, users []User) error {
+	return replaceRecords(tx, "DELETE FROM users", "INSERT INTO users (user_id, timezone, embeds, language, units, location) VALUES (?, ?, ?, ?, ?, ?)", users, func(u User) []interface{} {
+		return []interface{}{u.ID, u.Timezone, u.Embeds, u.Language, u.Units, u.Location}
+	})
+}
+
+func scanBettor(rows *sql.Rows) (b Bettor, err error) {
+	err = rows.Scan(&b.ID, &b.Points)
+	return
+}
+
+func (ss *sqlStore) loadBettors(q queryer) ([]Bettor, error) {
+	return queryRecords(q, scanBettor, "SELECT user_id, points FROM bettors WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveBettors(tx *sql.Tx, bettors []Bettor) error {
+	return replaceRecords(tx, "DELETE FROM bettors WHERE guild_id = ?", "INSERT INTO bettors (user_id, points, guild_id) VALUES (?, ?, ?)", bettors, func(b Bettor) []interface{} {
+		return []interface{}{b.ID, b.Points, ss.guild}
+	}, ss.guild)
+}
+
+func scanBet(rows *sql.Rows) (b Bet, err error) {
+	err = rows.Scan(&b.Race, &b.User, &b.Drivers[0], &b.Drivers[1], &b.Drivers[2], &b.Points)
+	return
+}
+
+func (ss *sqlStore) loadBets(q queryer) ([]Bet, error) {
+	return queryRecords(q, scanBet, "SELECT race, user_id, first, second, third, points FROM bets WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveBets(tx *sql.Tx, bets []Bet) error {
+	return replaceRecords(tx, "DELETE FROM bets WHERE guild_id = ?", "INSERT INTO bets (race, user_id, first, second, third, points, guild_id) VALUES (?, ?, ?, ?, ?, ?, ?)", bets, func(b Bet) []interface{} {
+		return []interface{}{b.Race, b.User, b.Drivers[0], b.Drivers[1], b.Drivers[2], b.Points, ss.guild}
+	}, ss.guild)
+}
+
+func scanEvent(rows *sql.Rows) (e Event, err error) {
+	var start string
+	err = rows.Scan(&e.Category, &e.Name, &e.Session, &start, &e.Channel, &e.Image, &e.Mention)
+	if err != nil {
+		return
+	}
+	e.Time, err = time.Parse(time.RFC3339, start)
+	return
+}
+
+func (ss *sqlStore) loadEvents(q queryer) ([]Event, error) {
+	return queryRecords(q, scanEvent, "SELECT category, name, session, start, channel, image, mention FROM events WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveEvents(tx *sql.Tx, events []Event) error {
+	return replaceRecords(tx, "DELETE FROM events WHERE guild_id = ?", "INSERT INTO events (category, name, session, start, channel, image, mention, guild_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", events, func(e Event) []interface{} {
+		return []interface{}{e.Category, e.Name, e.Session, e.Time.UTC().Format(time.RFC3339), e.Channel, e.Image, e.Mention, ss.guild}
+	}, ss.guild)
+}
+
+// The time before the start of each reminder is kept in seconds.
+func scanReminder(rows *sql.Rows) (r SentReminder, err error) {
+	var start string
+	var before int64
+	err = rows.Scan(&r.Category, &r.Name, &r.Session, &start, &before)
+	if err != nil {
+		return
+	}
+	r.Before = time.Duration(before) * time.Second
+	r.Time, err = time.Parse(time.RFC3339, start)
+	return
+}
+
+func (ss *sqlStore) loadReminders(q queryer) ([]SentReminder, error) {
+	return queryRecords(q, scanReminder, "SELECT category, name, session, start, before_start FROM reminders WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveReminders(tx *sql.Tx, reminders []SentReminder) error {
+	return replaceRecords(tx, "DELETE FROM reminders WHERE guild_id = ?", "INSERT INTO reminders (category, name, session, start, before_start, guild_id) VALUES (?, ?, ?, ?, ?, ?)", reminders, func(r SentReminder) []interface{} {
+		return []interface{}{r.Category, r.Name, r.Session, r.Time.UTC().Format(time.RFC3339), int64(r.Before / time.Second), ss.guild}
+	}, ss.guild)
+}
+
+func scanFeed(rows *sql.Rows) (f Feed, err error) {
+	var last string
+	err = rows.Scan(&f.Name, &f.URL, &f.Channel, &last)
+	if err != nil || last == "" {
+		return
+	}
+	f.Last, err = time.Parse(time.RFC3339Nano, last)
+	return
+}
+
+func (ss *sqlStore) loadFeeds(q queryer) ([]Feed, error) {
+	return queryRecords(q, scanFeed, "SELECT name, url, channel, last FROM feeds WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveFeeds(tx *sql.Tx, feeds []Feed) error {
+	return replaceRecords(tx, "DELETE FROM feeds WHERE guild_id = ?", "INSERT INTO feeds (name, url, channel, last, guild_id) VALUES (?, ?, ?, ?, ?)", feeds, func(f Feed) []interface{} {
+		last := ""
+		if !f.Last.IsZero() {
+			last = f.Last.Format(time.RFC3339Nano)
+		}
+		return []interface{}{f.Name, f.URL, f.Channel, last, ss.guild}
+	}, ss.guild)
+}
+
+func scanQuote(rows *sql.Rows) (q Quote, err error) {
+	err = rows.Scan(&q.Date, &q.Text, &q.Channel)
+	return
+}
+
+func (ss *sqlStore) loadQuotes(q queryer) ([]Quote, error) {
+	return queryRecords(q, scanQuote, "SELECT date, text, channel FROM quotes WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveQuotes(tx *sql.Tx, quotes []Quote) error {
+	return replaceRecords(tx, "DELETE FROM quotes WHERE guild_id = ?", "INSERT INTO quotes (date, text, channel, guild_id) VALUES (?, ?, ?, ?)", quotes, func(q Quote) []interface{} {
+		return []interface{}{q.Date, q.Text, q.Channel, ss.guild}
+	}, ss.guild)
+}
+
+func scanStat(rows *sql.Rows) (s Stat, err error) {
+	err = rows.Scan(&s.User, &s.Messages)
+	return
+}
+
+func (ss *sqlStore) loadStats(q queryer) ([]Stat, error) {
+	return queryRecords(q, scanStat, "SELECT user_id, messages FROM stats WHERE guild_id = ? ORDER BY id", ss.guild)
+}
+
+func (ss *sqlStore) saveStats(tx *sql.Tx, stats []Stat) error {
+	return replaceRecords(tx, "DELETE FROM stats WHERE guild_id = ?", "INSERT INTO stats (user_id, messages, guild_id) VALUES (?, ?, ?)", stats, func(s Stat) []interface{} {
+		return []interface{}{s.User, s.Messages, ss.guild}
+	}, ss.guild)
+}
+
+// Small utility function that returns the first record of a query or ErrNotFound if there is none.
+func first[T any](records []T, err error) (record T, _ error) {
+	if err != nil {
+		return record, err
+	}
+	if len(records) == 0 {
+		return record, ErrNotFound
+	}
+	return records[0], nil
+}
+
+func (ss *sqlStore) Guild(id string) Store {
+	partition := cfg().partition(id)
+	return &sqlStore{db: ss.db, files: &csvStore{guild: partition}, guild: partition}
+}
+
+func (ss *sqlStore) Users() ([]User, error) {
+	return loadUsers(ss.db)
+}
+
+func (ss *sqlStore) User(id string) (User, error) {
+	return first(queryRecords(ss.db, scanUser, "SELECT user_id, timezone, embeds, language, units, location FROM users WHERE user_id = ? COLLATE NOCASE ORDER BY id LIMIT 1", id))
+}
+
+func (ss *sqlStore) SaveUsers(users []User) error {
+	return ss.inTx(func(tx *sql.Tx) error { return saveUsers(tx, users) })
+}
+
+func (ss *sqlStore) UpdateUsers(fn func(users []User) ([]User, error)) error {
+	return updateRecords(ss, loadUsers, saveUsers, fn)
+}
+
+func (ss *sqlStore) Bettors() ([]Bettor, error) {
+	return ss.loadBettors(ss.db)
+}
+
+func (ss *sqlStore) SaveBettors(bettors []Bettor) error {
+	return ss.inTx(func(tx *sql.Tx) error { return ss.saveBettors(tx, bettors) })
+}
+
+func (ss *sqlStore) UpdateBettors(fn func(bettors []Bettor) ([]Bettor, error)) error {
+	return updateRecords(ss, ss.loadBettors, ss.saveBettors, fn)
+}
+
+func (ss *sqlStore) Bets() ([]Bet, error) {
+	return ss.loadBets(ss.db)
+}
+
+func (ss *sqlStore) Bet(race string, user string) (Bet, error) {
+	return first(queryRecords(ss.db, scanBet,
+		"SELECT race, user_id, first, second, third, points FROM bets WHERE guild_id = ? AND race = ? COLLATE NOCASE AND user_id = ? COLLATE NOCASE ORDER BY id DESC LIMIT 1",
+		ss.guild, race, user))
+}
+
+func (ss *sqlStore) SaveBets(bets []Bet) error {
+	return ss.inTx(func(tx *sql.Tx) error { return ss.saveBets(tx, bets) })
+}
+
+func (ss *sqlStore) UpdateBets(fn func(bets []Bet) ([]Bet, error)) error {
+	return updateRecords(ss, ss.loadBets, ss.saveBets, fn)
+}
+
+// The DataVersion method returns the data version of the database, which SQLite changes whenever another connection
+// commits a change, like another program writing to it. The database uses a single connection, so the writes of the bot
+// itself don't change it.
+func (ss *sqlStore) DataVersion() (version int64, err error) {
+	err = ss.db.QueryRow("PRAGMA data_version").Scan(&version)
+	return
+}
+
+func (ss *sqlStore) Events() ([]Event, error) {
+	return ss.loadEvents(ss.db)
+}
+
+func (ss *sqlStore) SaveEvents(events []Event) error {
+	return ss.inTx(func(tx *sql.Tx) error { return ss.saveEvents(tx, events) })
+}
+
+func (ss *sqlStore) UpdateEvents(fn func(events []Event) ([]Event, error)) error {
+	return updateRecords(ss, ss.loadEvents, ss.saveEvents, fn)
+}
+
+func (ss *sqlStore) Reminders() ([]SentReminder, error) {
+	return ss.loadReminders(ss.db)
+}
+
+func (ss *sqlStore) UpdateReminders(fn func(reminders []SentReminder) ([]SentReminder, error)) error {
+	return updateRecords(ss, ss.loadReminders, ss.saveReminders, fn)
+}
+
+func (ss *sqlStore) Feeds() ([]Feed, error) {
+	return ss.loadFeeds(ss.db)
+}
+
+func (ss *sqlStore) SaveFeeds(feeds []Feed) error {
+	return ss.inTx(func(tx *sql.Tx) error { return ss.saveFeeds(tx, feeds) })
+}
+
+func (ss *sqlStore) UpdateFeeds(fn func(feeds []Feed) ([]Feed, error)) error {
+	return updateRecords(ss, ss.loadFeeds, ss.saveFeeds, fn)
+}
+
+func (ss *sqlStore) Quotes() ([]Quote, error) {
+	return ss.loadQuotes(ss.db)
+}
+
+func (ss *sqlStore) SaveQuotes(quotes []Quote) error {
+	return ss.inTx(func(tx *sql.Tx) error { return ss.saveQuotes(tx, quotes) })
+}
+
+func (ss *sqlStore) UpdateQuotes(fn func(quotes []Quote) ([]Quote, error)) error {
+	return updateRecords(ss, ss.loadQuotes, ss.saveQuotes, fn)
+}
+
+func (ss *sqlStore) Roles() ([]Role, error) {
+	return ss.files.Roles()
+}
+
+func (ss *sqlStore) Drivers() ([]Driver, error) {
+	return ss.files.Drivers()
+}
+
+func (ss *sqlStore) Result() (Result, error) {
+	return ss.files.Result()
+}
+
+func (ss *sqlStore) SaveResult(result Result) error {
+	return ss.files.SaveResult(result)
+}
+
+func (ss *sqlStore) UpdateResult(fn func(result Result) (Result, error)) error {
+	return ss.files.UpdateResult(fn)
+}
+
+func (ss *sqlStore) Stats() ([]Stat, error) {
+	return ss.loadStats(ss.db)
+}
+
+func (ss *sqlStore) SaveStats(stats []Stat) error {
+	return ss.inTx(func(tx *sql.Tx) error { return ss.saveStats(tx, stats) })
+}
+
+func (ss *sqlStore) UpdateStats(fn func(stats []Stat) ([]Stat, error)) error {
+	return updateRecords(ss, ss.loadStats, ss.saveStats, fn)
+}
+
+func (ss *sqlStore) Aliases() ([]Alias, error) {
+	return ss.files.Aliases()
+}
+
+func (ss *sqlStore) Alias(search string) (string, error) {
+	return ss.files.Alias(search)
+}
+
+func (ss *sqlStore) Answers() ([]string, error) {
+	return ss.files.Answers()
+}
+
+func (ss *sqlStore) Usage() ([]Usage, error) {
+	return ss.files.Usage()
+}
+
+func (ss *sqlStore) Disabled() ([]DisabledCommand, error) {
+	return ss.files.Disabled()
+}
+
+func (ss *sqlStore) SaveDisabled(disabled []DisabledCommand) error {
+	return ss.files.SaveDisabled(disabled)
+}
+
+func (ss *sqlStore) UpdateDisabled(fn func(disabled []DisabledCommand) ([]DisabledCommand, error)) error {
+	return ss.files.UpdateDisabled(fn)
+}
+
+func (ss *sqlStore) Close() error {
+	return ss.db.Close()
+}
+
+// The importCSV function copies all the data the bot writes from the CSV files into the database.
+// This is a one-shot migration, so it refuses to run on a database that already has data unless force is set,
+// in which case the tables are overwritten with the contents of the CSV files. Missing CSV files are skipped.
+// Weather settings and time zones of older versions are first merged into the users file (see mergeProfiles).
+func importCSV(src *csvStore, dst *sqlStore, force bool) (summary []string, err error) {
+	if !force {
+		for _, table := range []string{"users", "bettors", "bets", "events", "feeds", "quotes", "reminders", "stats"} {
+			var count int
+			err = dst.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+			if err != nil {
+				return
+			}
+			if count > 0 {
+				err = fmt.Errorf("the %s table already has data, use -force to overwrite it", table)
+				return
+			}
+		}
+	}
+	merged, err := mergeProfiles(src)
+	if err != nil {
+		return
+	}
+	summary = append(summary, merged...)
+	// Each step loads one CSV file and saves it to its table, all steps share a single transaction so that a
+	// failure half way through leaves the database as it was before the migration.
+	type step struct {
+		path string
+		copy func(tx *sql.Tx) (int, error)
+	}
+	steps := []step{
+		{src.files().Users, func(tx *sql.Tx) (int, error) { return importRecords(tx, src.Users, saveUsers) }},
+	}
+	// The server data files are imported once per partition, each into the rows of its own guild.
+	for _, partition := range cfg().partitions() {
+		from := &csvStore{guild: partition}
+		to := &sqlStore{db: dst.db, files: from, guild: partition}
+		steps = append(steps,
+			step{from.files().Bet, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Bettors, to.saveBettors) }},
+			step{from.files().Bets, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Bets, to.saveBets) }},
+			step{from.files().Events, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Events, to.saveEvents) }},
+			step{from.files().Feeds, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Feeds, to.saveFeeds) }},
+			step{from.files().Quotes, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Quotes, to.saveQuotes) }},
+			step{from.files().Reminders, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Reminders, to.saveReminders) }},
+			step{from.files().Stats, func(tx *sql.Tx) (int, error) { return importRecords(tx, from.Stats, to.saveStats) }},
+		)
+	}
+	err = dst.inTx(func(tx *sql.Tx) error {
+		for _, s := range steps {
+			if !fileExists(s.path) {
+				summary = append(summary, fmt.Sprintf("%s: skipped (file not found)", s.path))
+				continue
+			}
+			n, err := s.copy(tx)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.path, err)
+			}
+			summary = append(summary, fmt.Sprintf("%s: %d records imported", s.path, n))
+		}
+		return nil
+	})
+	if err != nil {
+		summary = nil
+	}
+	return
+}
+
+// Small utility function that loads records from one backend and saves them to a table of the database.
+func importRecords[T any](tx *sql.Tx, load func() ([]T, error), save func(tx *sql.Tx, records []T) error) (int, error) {
+	records, err := load()
+	if err != nil {
+		return 0, err
+	}
+	return len(records), save(tx, records)
+}
@@ -0,0 +1,694 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	eventTimeFormat = "2006-01-02 15:04:05 UTC"                 // Time format of the date column of the events file.
+	feedTimeFormat  = "2006-01-02 15:04:05.999999999 -0700 MST" // Time format of the last time column of the feeds file.
+)
+
+var (
+	// Error returned by the query methods of a Store when no record matches the query.
+	ErrNotFound = errors.New("record not found")
+	// Error that update functions return to leave the data untouched without the update failing.
+	ErrNoChange = errors.New("no change")
+)
+
+// Type that represents the profile of a user (users file), with the settings every command uses, on every guild.
+// IDs are stored in lower case (see newUser) and looked up ignoring case.
+type User struct {
+	ID       string
+	Timezone string
+	Embeds   bool
+	Language string // Language of the messages sent to the user, empty for the one of the guild.
+	Units    string // Units of the weather, c for Celsius or f for Fahrenheit.
+	Location string // Location of the weather when none is given.
+}
+
+// Type that represents a user taking part on the bet game of a guild (bet file).
+type Bettor struct {
+	ID     string
+	Points int
+}
+
+// Type that represents a bet placed by a user for a race (bets file).
+type Bet struct {
+	Race    string
+	User    string
+	Drivers [3]string
+	Points  int
+}
+
+// Type that represents a scheduled event (events file).
+type Event struct {
+	Category string
+	Name     string
+	Session  string
+	Time     time.Time
+	Channel  string
+	Image    string
+	Mention  string
+}
+
+// Type that represents a news feed polled by the bot (feeds file).
+type Feed struct {
+	Name    string
+	URL     string
+	Channel string
+	Last    time.Time
+}
+
+// Type that represents a quote added to a channel (quotes file).
+type Quote struct {
+	Date    string
+	Text    string
+	Channel string
+}
+
+// Type that represents a server role users can add themselves to (roles file).
+type Role struct {
+	Name string
+}
+
+// Type that represents a driver that can be picked on a bet (drivers file).
+type Driver struct {
+	Name string
+	Code string
+	Odds int
+}
+
+// Type that represents the podium of the last race and the last race whose bets were processed (results file).
+type Result struct {
+	Race      string
+	Podium    [3]string
+	Processed string
+}
+
+// Type that represents a reminder of an event that was already sent (reminders file), before is how long before
+// the start of the event it was due. Events moved to another start get their reminders again.
+type SentReminder struct {
+	Category string
+	Name     string
+	Session  string
+	Time     time.Time
+	Before   time.Duration
+}
+
+// Type that represents the number of messages sent by a user (stats file).
+type Stat struct {
+	User     string
+	Messages int
+}
+
+// Type that represents an abbreviated search term and its expansion (alias file).
+type Alias struct {
+	Alias string
+	Value string
+}
+
+// Type that represents the usage message of a command (usage file).
+type Usage struct {
+	Command string
+	Text    string
+}
+
+// Type that represents a command or plugin disabled on a channel, on a category or on a whole server (disabled file).
+// Scope is either channel, category or guild and ID is the ID of that channel, category or guild. Rows written by
+// older versions only have the command, which is then disabled on every guild using the file.
+type DisabledCommand struct {
+	Command string
+	Scope   string
+	ID      string
+}
+
+// The Store interface abstracts away how the bot persists its data, so that commands deal with typed records.
+// Each kind of record can be loaded as a whole, saved as a whole or, for the most common lookups, queried.
+// Query methods return ErrNotFound when there is no matching record, so callers can tell it from real errors.
+// Update methods run a whole read-modify-write cycle while no other writer can touch the same data, which is
+// what commands must use instead of a load followed by a save. If fn returns an error nothing is written and
+// the error is returned, except for ErrNoChange which makes the update succeed without writing anything.
+// The data of each server lives on its own partition (see Config.partition), Guild returns the Store of a guild.
+type Store interface {
+	Guild(id string) Store
+	Users() ([]User, error)
+	User(id string) (User, error)
+	SaveUsers(users []User) error
+	UpdateUsers(fn func(users []User) ([]User, error)) error
+	Bettors() ([]Bettor, error)
+	SaveBettors(bettors []Bettor) error
+	UpdateBettors(fn func(bettors []Bettor) ([]Bettor, error)) error
+	Bets() ([]Bet, error)
+	Bet(race string, user string) (Bet, error)
+	SaveBets(bets []Bet) error
+	UpdateBets(fn func(bets []Bet) ([]Bet, error)) error
+	Events() ([]Event, error)
+	SaveEvents(events []Event) error
+	UpdateEvents(fn func(events []Event) ([]Event, error)) error
+	Reminders() ([]SentReminder, error)
+	UpdateReminders(fn func(reminders []SentReminder) ([]SentReminder, error)) error
+	Feeds() ([]Feed, error)
+	SaveFeeds(feeds []Feed) error
+	UpdateFeeds(fn func(feeds []Feed) ([]Feed, error)) error
+	Quotes() ([]Quote, error)
+	SaveQuotes(quotes []Quote) error
+	UpdateQuotes(fn func(quotes []Quote) ([]Quote, error)) error
+	Roles() ([]Role, error)
+	Drivers() ([]Driver, error)
+	Result() (Result, error)
+	SaveResult(result Result) error
+	UpdateResult(fn func(result Result) (Result, error)) error
+	Stats() ([]Stat, error)
+	SaveStats(stats []Stat) error
+	UpdateStats(fn func(stats []Stat) ([]Stat, error)) error
+	Aliases() ([]Alias, error)
+	Alias(search string) (string, error)
+	Answers() ([]string, error)
+	Usage() ([]Usage, error)
+	Disabled() ([]DisabledCommand, error)
+	SaveDisabled(disabled []DisabledCommand) error
+	UpdateDisabled(fn func(disabled []DisabledCommand) ([]DisabledCommand, error)) error
+	// Close must only be called on the Store returned by openStore, which the guild stores depend on.
+	Close() error
+}
+
+// Interface of the stores whose data can be changed by other programs while the bot runs, like the database by the
+// sqlite3 shell. DataVersion returns a number that changes whenever another program changes the data, so that the data kept
+// in memory can be read again. Changes made through the store itself don't change it.
+type versionedStore interface {
+	DataVersion() (int64, error)
+}
+
+// Type that implements the Store interface on top of the CSV files historically used by the bot.
+// Rows shorter than expected are padded with empty columns instead of making the bot crash.
+// The paths of the files are taken from the current configuration on every call, so they can be reloaded.
+type csvStore struct {
+	guild string // Partition of the data used by this store, empty for the files of the files section.
+}
+
+// The NewCSVStore function returns a Store backed by the CSV files defined on the configuration.
+func NewCSVStore() Store {
+	return &csvStore{}
+}
+
+func (cs *csvStore) files() FilesConfig {
+	return cfg().files(cs.guild)
+}
+
+func (cs *csvStore) Guild(id string) Store {
+	return &csvStore{guild: cfg().partition(id)}
+}
+
+// The openStore function returns the Store for the given backend name, which is either csv (the default) or sqlite.
+func openStore(backend string, database string) (Store, error) {
+	switch strings.ToLower(backend) {
+	case "", "csv":
+		return NewCSVStore(), nil
+	case "sqlite":
+		return NewSQLStore(database)
+	default:
+		return nil, errors.New("unknown storage backend: " + backend)
+	}
+}
+
+// Small utility function that returns the column i of a CSV row or an empty string if the row is too short.
+func field(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// Small utility function that returns the column i of a CSV row as an integer, or zero if it isn't a number.
+func intField(row []string, i int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(field(row, i)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Small utility function that converts the rows of a CSV file to records using parse, skipping empty rows.
+func parseRows[T any](data [][]string, parse func(row []string) (T, error)) (records []T, err error) {
+	for i, row := range data {
+		if len(row) == 0 || (len(row) == 1 && row[0] == "") {
+			continue
+		}
+		record, err := parse(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// Small utility function that converts records to CSV rows using format.
+func formatRows[T any](records []T, format func(record T) []string) [][]string {
+	data := make([][]string, 0, len(records))
+	for _, record := range records {
+		data = append(data, format(record))
+	}
+	return data
+}
+
+// Small utility function that reads a CSV file and converts each non empty row to a record using parse.
+func loadCSV[T any](path string, parse func(row []string) (T, error)) (records []T, err error) {
+	data, err := readCSV(path)
+	if err != nil {
+		return
+	}
+	return parseRows(data, parse)
+}
+
+// Small utility function like loadCSV, except that the rows that can't be converted are logged and skipped instead
+// of failing the whole file, for files edited by hand that are worth reading even with a few mistakes.
+func loadValidCSV[T any](path string, parse func(row []string) (T, error)) (records []T, err error) {
+	data, err := readCSV(path)
+	if err != nil {
+		return
+	}
+	for i, row := range data {
+		if len(row) == 0 || (len(row) == 1 && row[0] == "") {
+			continue
+		}
+		record, err := parse(row)
+		if err != nil {
+			log.Printf("%s: skipping row %d: %s", path, i+1, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Small utility function that converts each record to a CSV row using format and writes them to a CSV file.
+func saveCSV[T any](path string, records []T, format func(record T) []string) error {
+	return writeCSV(path, formatRows(records, format))
+}
+
+// Small utility function that runs a read-modify-write cycle on a CSV file while holding its lock.
+// A missing file is treated as an empty one, so that the first update creates it.
+func updateCSV[T any](path string, parse func(row []string) (T, error), format func(record T) []string, fn func(records []T) ([]T, error)) error {
+	unlock := lockFile(path)
+	defer unlock()
+	var records []T
+	var err error
+	if fileExists(path) {
+		records, err = loadCSV(path, parse)
+		if err != nil {
+			return err
+		}
+	}
+	records, err = fn(records)
+	if errors.Is(err, ErrNoChange) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeCSVLocked(path, formatRows(records, format))
+}
+
+// Functions that convert each kind of record from and to a row of its CSV file.
+
+func parseUser(row []string) (User, error) {
+	u := User{
+		ID:       field(row, 0),
+		Timezone: field(row, 1),
+		Embeds:   strings.Contains(strings.ToLower(field(row, 2)), "embeds"),
+		Language: field(row, 3),
+		Units:    field(row, 4),
+		Location: field(row, 5),
+	}
+	if u.Units == "" {
+		u.Units = "c"
+	}
+	return u, nil
+}
+
+func formatUser(u User) []string {
+	embeds := ""
+	if u.Embeds {
+		embeds = "embeds"
+	}
+	return []string{u.ID, u.Timezone, embeds, u.Language, u.Units, u.Location}
+}
+
+// The second column of the bet file held the time zone of each bettor, which is now on the profile of the user.
+// It is kept empty, so that the files written by older versions can still be read.
+
+func parseBettor(row []string) (Bettor, error) {
+	return Bettor{ID: field(row, 0), Points: intField(row, 2)}, nil
+}
+
+func formatBettor(b Bettor) []string {
+	return []string{b.ID, "", strconv.Itoa(b.Points)}
+}
+
+func parseBet(row []string) (Bet, error) {
+	return Bet{
+		Race:    field(row, 0),
+		User:    field(row, 1),
+		Drivers: [3]string{field(row, 2), field(row, 3), field(row, 4)},
+		Points:  intField(row, 5),
+	}, nil
+}
+
+func formatBet(b Bet) []string {
+	return []string{b.Race, b.User, b.Drivers[0], b.Drivers[1], b.Drivers[2], strconv.Itoa(b.Points)}
+}
+
+func parseEvent(row []string) (e Event, err error) {
+	t, err := time.Parse(eventTimeFormat, field(row, 3))
+	if err != nil {
+		err = errors.New("error parsing time")
+		return
+	}
+	e = Event{
+		Category: field(row, 0),
+		Name:     field(row, 1),
+		Session:  field(row, 2),
+		Time:     t,
+		Channel:  field(row, 4),
+		Image:    field(row, 5),
+		Mention:  field(row, 6),
+	}
+	return
+}
+
+func formatEvent(e Event) []string {
+	return []string{e.Category, e.Name, e.Session, e.Time.UTC().Format(eventTimeFormat), e.Channel, e.Image, e.Mention}
+}
+
+func parseReminder(row []string) (r SentReminder, err error) {
+	t, err := time.Parse(eventTimeFormat, field(row, 3))
+	if err != nil {
+		err = errors.New("error parsing time")
+		return
+	}
+	before, err := time.ParseDuration(field(row, 4))
+	if err != nil {
+		err = errors.New("error parsing duration")
+		return
+	}
+	return SentReminder{Category: field(row, 0), Name: field(row, 1), Session: field(row, 2), Time: t, Before: before}, nil
+}
+
+func formatReminder(r SentReminder) []string {
+	return []string{r.Category, r.Name, r.Session, r.Time.UTC().Format(eventTimeFormat), r.Before.String()}
+}
+
+func parseFeed(row []string) (Feed, error) {
+	// The last time column is empty for new feeds, in which case we leave it as the zero time.
+	last, _ := time.Parse(feedTimeFormat, field(row, 3))
+	return Feed{Name: field(row, 0), URL: field(row, 1), Channel: field(row, 2), Last: last}, nil
+}
+
+func formatFeed(f Feed) []string {
+	last := ""
+	if !f.Last.IsZero() {
+		last = f.Last.Format(feedTimeFormat)
+	}
+	return []string{f.Name, f.URL, f.Channel, last}
+}
+
+func parseQuote(row []string) (Quote, error) {
+	return Quote{Date: field(row, 0), Text: field(row, 1), Channel: field(row, 2)}, nil
+}
+
+func formatQuote(q Quote) []string {
+	return []string{q.Date, q.Text, q.Channel}
+}
+
+func parseResult(row []string) (Result, error) {
+	return Result{
+		Race:      field(row, 0),
+		Podium:    [3]string{field(row, 1), field(row, 2), field(row, 3)},
+		Processed: field(row, 4),
+	}, nil
+}
+
+func formatResult(r Result) []string {
+	return []string{r.Race, r.Podium[0], r.Podium[1], r.Podium[2], r.Processed}
+}
+
+func parseStat(row []string) (Stat, error) {
+	return Stat{User: field(row, 0), Messages: intField(row, 1)}, nil
+}
+
+func formatStat(s Stat) []string {
+	return []string{s.User, strconv.Itoa(s.Messages)}
+}
+
+func parseDisabledCommand(row []string) (DisabledCommand, error) {
+	d := DisabledCommand{Command: field(row, 0), Scope: field(row, 1), ID: field(row, 2)}
+	if d.Scope == "" {
+		d.Scope = "guild"
+	}
+	return d, nil
+}
+
+func formatDisabledCommand(d DisabledCommand) []string {
+	return []string{d.Command, d.Scope, d.ID}
+}
+
+func (cs *csvStore) Users() ([]User, error) {
+	return loadCSV(cs.files().Users, parseUser)
+}
+
+func (cs *csvStore) User(id string) (user User, err error) {
+	users, err := cs.Users()
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.ID, id) {
+			return u, nil
+		}
+	}
+	err = ErrNotFound
+	return
+}
+
+func (cs *csvStore) SaveUsers(users []User) error {
+	return saveCSV(cs.files().Users, users, formatUser)
+}
+
+func (cs *csvStore) UpdateUsers(fn func(users []User) ([]User, error)) error {
+	return updateCSV(cs.files().Users, parseUser, formatUser, fn)
+}
+
+func (cs *csvStore) Bettors() ([]Bettor, error) {
+	return loadCSV(cs.files().Bet, parseBettor)
+}
+
+func (cs *csvStore) SaveBettors(bettors []Bettor) error {
+	return saveCSV(cs.files().Bet, bettors, formatBettor)
+}
+
+func (cs *csvStore) UpdateBettors(fn func(bettors []Bettor) ([]Bettor, error)) error {
+	return updateCSV(cs.files().Bet, parseBettor, formatBettor, fn)
+}
+
+func (cs *csvStore) Bets() ([]Bet, error) {
+	return loadCSV(cs.files().Bets, parseBet)
+}
+
+func (cs *csvStore) Bet(race string, user string) (bet Bet, err error) {
+	bets, err := cs.Bets()
+	if err != nil {
+		return
+	}
+	for i := len(bets) - 1; i >= 0; i-- {
+		if strings.EqualFold(bets[i].Race, race) && strings.EqualFold(bets[i].User, user) {
+			return bets[i], nil
+		}
+	}
+	err = ErrNotFound
+	return
+}
+
+func (cs *csvStore) SaveBets(bets []Bet) error {
+	return saveCSV(cs.files().Bets, bets, formatBet)
+}
+
+func (cs *csvStore) UpdateBets(fn func(bets []Bet) ([]Bet, error)) error {
+	return updateCSV(cs.files().Bets, parseBet, formatBet, fn)
+}
+
+// The events file is often edited by hand, so a bad row doesn't hide the other events. Updates still fail on it,
+// so that it isn't dropped from the file.
+func (cs *csvStore) Events() ([]Event, error) {
+	return loadValidCSV(cs.files().Events, parseEvent)
+}
+
+func (cs *csvStore) SaveEvents(events []Event) error {
+	return saveCSV(cs.files().Events, events, formatEvent)
+}
+
+func (cs *csvStore) UpdateEvents(fn func(events []Event) ([]Event, error)) error {
+	return updateCSV(cs.files().Events, parseEvent, formatEvent, fn)
+}
+
+// The reminders file is written by the bot alone, so it doesn't have to exist until the first reminder is sent.
+func (cs *csvStore) Reminders() ([]SentReminder, error) {
+	if !fileExists(cs.files().Reminders) {
+		return nil, nil
+	}
+	return loadCSV(cs.files().Reminders, parseReminder)
+}
+
+func (cs *csvStore) UpdateReminders(fn func(reminders []SentReminder) ([]SentReminder, error)) error {
+	return updateCSV(cs.files().Reminders, parseReminder, formatReminder, fn)
+}
+
+func (cs *csvStore) Feeds() ([]Feed, error) {
+	return loadCSV(cs.files().Feeds, parseFeed)
+}
+
+func (cs *csvStore) SaveFeeds(feeds []Feed) error {
+	return saveCSV(cs.files().Feeds, feeds, formatFeed)
+}
+
+func (cs *csvStore) UpdateFeeds(fn func(feeds []Feed) ([]Feed, error)) error {
+	return updateCSV(cs.files().Feeds, parseFeed, formatFeed, fn)
+}
+
+func (cs *csvStore) Quotes() ([]Quote, error) {
+	return loadCSV(cs.files().Quotes, parseQuote)
+}
+
+func (cs *csvStore) SaveQuotes(quotes []Quote) error {
+	return saveCSV(cs.files().Quotes, quotes, formatQuote)
+}
+
+func (cs *csvStore) UpdateQuotes(fn func(quotes []Quote) ([]Quote, error)) error {
+	return updateCSV(cs.files().Quotes, parseQuote, formatQuote, fn)
+}
+
+func (cs *csvStore) Roles() ([]Role, error) {
+	return loadCSV(cs.files().Roles, func(row []string) (Role, error) {
+		return Role{Name: field(row, 0)}, nil
+	})
+}
+
+func (cs *csvStore) Drivers() ([]Driver, error) {
+	return loadCSV(cs.files().Drivers, func(row []string) (Driver, error) {
+		return Driver{Name: field(row, 0), Code: field(row, 1), Odds: intField(row, 2)}, nil
+	})
+}
+
+func (cs *csvStore) Result() (result Result, err error) {
+	results, err := loadCSV(cs.files().Results, parseResult)
+	if err != nil {
+		return
+	}
+	if len(results) == 0 {
+		err = ErrNotFound
+		return
+	}
+	result = results[0]
+	return
+}
+
+func (cs *csvStore) SaveResult(result Result) error {
+	return saveCSV(cs.files().Results, []Result{result}, formatResult)
+}
+
+func (cs *csvStore) UpdateResult(fn func(result Result) (Result, error)) error {
+	return updateCSV(cs.files().Results, parseResult, formatResult, func(results []Result) ([]Result, error) {
+		if len(results) == 0 {
+			return nil, ErrNotFound
+		}
+		result, err := fn(results[0])
+		if err != nil {
+			return nil, err
+		}
+		return []Result{result}, nil
+	})
+}
+
+func (cs *csvStore) Stats() ([]Stat, error) {
+	return loadCSV(cs.files().Stats, parseStat)
+}
+
+func (cs *csvStore) SaveStats(stats []Stat) error {
+	return saveCSV(cs.files().Stats, stats, formatStat)
+}
+
+func (cs *csvStore) UpdateStats(fn func(stats []Stat) ([]Stat, error)) error {
+	return updateCSV(cs.files().Stats, parseStat, formatStat, fn)
+}
+
+func (cs *csvStore) Aliases() ([]Alias, error) {
+	return loadCSV(cs.files().Alias, func(row []string) (Alias, error) {
+		return Alias{Alias: field(row, 0), Value: field(row, 1)}, nil
+	})
+}
+
+func (cs *csvStore) Alias(search string) (result string, err error) {
+	aliases, err := cs.Aliases()
+	if err != nil {
+		return
+	}
+	for _, a := range aliases {
+		if strings.EqualFold(search, a.Alias) {
+			return a.Value, nil
+		}
+	}
+	err = ErrNotFound
+	return
+}
+
+func (cs *csvStore) Answers() ([]string, error) {
+	return loadCSV(cs.files().Answers, func(row []string) (string, error) {
+		return field(row, 0), nil
+	})
+}
+
+func (cs *csvStore) Usage() ([]Usage, error) {
+	return loadCSV(cs.files().Usage, func(row []string) (Usage, error) {
+		return Usage{Command: field(row, 0), Text: field(row, 1)}, nil
+	})
+}
+
+func (cs *csvStore) Disabled() ([]DisabledCommand, error) {
+	return loadCSV(cs.files().Disabled, parseDisabledCommand)
+}
+
+func (cs *csvStore) SaveDisabled(disabled []DisabledCommand) error {
+	return saveCSV(cs.files().Disabled, disabled, formatDisabledCommand)
+}
+
+func (cs *csvStore) UpdateDisabled(fn func(disabled []DisabledCommand) ([]DisabledCommand, error)) error {
+	return updateCSV(cs.files().Disabled, parseDisabledCommand, formatDisabledCommand, fn)
+}
+
+func (cs *csvStore) Close() error {
+	return nil
+}
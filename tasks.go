@@ -19,10 +19,9 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -30,7 +29,24 @@ import (
 )
 
 // The tskFeeds function runs in the background as a goroutine polling a collection of news feeds.
+// Every feedInterval seconds the feeds of all the guilds are polled at the same time, each by pollFeeds.
 func tskFeeds(dg *discordgo.Session) {
+	for {
+		time.Sleep(time.Duration(cfg().FeedInterval) * time.Second)
+		var wg sync.WaitGroup
+		for _, partition := range cfg().partitions() {
+			wg.Add(1)
+			go func(st Store) {
+				defer wg.Done()
+				pollFeeds(dg, st)
+			}(store.Guild(partition))
+		}
+		wg.Wait()
+	}
+}
+
+// The pollFeeds function opens the feeds CSV file of a guild, fetches its news and shows the new items.
+func pollFeeds(dg *discordgo.Session, st Store) {
 	// Simple structure type used to send feed data to a go channel.
 	// It stores a key that indexes each different feed and a value.
 	// This allows the reading thread (this function) to access those two variables from the channel.
@@ -39,180 +55,180 @@ func tskFeeds(dg *discordgo.Session) {
 		Key   int
 		Value *gofeed.Feed
 	}
-	var timeFormat = "2006-01-02 15:04:05 +0000 UTC" // Time format string used by the time package.
-	// Loop that runs every feedInterval seconds opening the feeds CSV file and fetching news.
+	feeds, err := st.Feeds()
+	feedDataCh := make(chan FeedData)
+	if err != nil {
+		log.Println("tskFeeds:", err)
+		return
+	}
+	// Loop that spawns a goroutine worker thread per each feed source in the feeds CSV file.
+	// The annonymous goroutine function accepts the k and v parameters, passed as arguments.
+	// This is to avoid undesired indeterministic effects from using a closure as a goroutine.
+	// The goroutine builds a Feed type by parsing the URL field for each feed in the CSV file.
+	// A FeedData type is built and sent to the go channel to be received by the reading thread.
+	for key, value := range feeds {
+		go func(k int, v Feed) {
+			fp := gofeed.NewParser()
+			feed, err := fp.ParseURL(v.URL)
+			if err != nil {
+				log.Println("feed:", err)
+				return
+			}
+			feedData := FeedData{k, feed}
+			feedDataCh <- feedData
+		}(key, value)
+	}
+	// Loop that runs a select on the go channel for as long as there's data to be read or until a timeout occurs.
+	// In case feedData can be read from the communication channel, process all the feed items and show new ones.
+	// In case this thread needs to wait more than 2 minutes to receive data from the goroutines a tiemout occurs.
 	for {
-		time.Sleep(time.Duration(feedInterval) * time.Second)
-		//start := time.Now()
-		feeds, err := readCSV(feedsFile)
-		feedDataCh := make(chan FeedData)
-		if err != nil {
-			log.Println("tskFeeds:", err)
-			continue
-		}
-		// Loop that spawns a goroutine worker thread per each feed source in the feeds CSV file.
-		// The annonymous goroutine function accepts the k and v parameters, passed as arguments.
-		// This is to avoid undesired indeterministic effects from using a closure as a goroutine.
-		// The goroutine builds a Feed type by parsing the URL field for each feed in the CSV file.
-		// A FeedData type is built and sent to the go channel to be received by the reading thread.
-		for key, value := range feeds {
-			go func(k int, v []string) {
-				fp := gofeed.NewParser()
-				feed, err := fp.ParseURL(v[1])
-				if err != nil {
-					log.Println("feed:", err)
-					return
+		select {
+		case feedData := <-feedDataCh:
+			for _, item := range feedData.Value.Items {
+				// The lastTime variable keeps track of when the last feed item was retrieved.
+				// If it was never set (first time) then it is the zero time, which is always in the past.
+				// Items without a parseable publishing time can't be compared, so we skip them.
+				lastTime := feeds[feedData.Key].Last
+				itemTime := item.PublishedParsed
+				if itemTime == nil {
+					continue
 				}
-				feedData := FeedData{k, feed}
-				feedDataCh <- feedData
-			}(key, value)
-		}
-		// Loop that runs a select on the go channel for as long as there's data to be read or until a timeout occurs.
-		// In case feedData can be read from the communication channel, process all the feed items and show new ones.
-		// In case this thread needs to wait more than 2 minutes to receive data from the goroutines a tiemout occurs.
-		for {
-			timeout := false
-			select {
-			case feedData := <-feedDataCh:
-				for _, item := range feedData.Value.Items {
-					// The lastTime variable keeps track of when the last feed item was retrieved.
-					// If we cannot parse the time (first time) then we use timeFormat as lastTime.
-					// We could use any time in the past here, but timeFormat is already available.
-					lastTime, err := time.Parse(timeFormat, feeds[feedData.Key][3])
-					if err != nil {
-						lastTime, _ = time.Parse(timeFormat, timeFormat)
+				// We only want to show a feed item if itemTime > lastTime.
+				// Additionally we also want to make sure the feed item is no older than 4 hours.
+				// This assures only current news when restarting the bot or changing the feeds.
+				if itemTime.After(lastTime) && time.Since((*itemTime)) < 8*time.Duration(hns) {
+					if strings.Contains(item.Link, "?") && strings.Contains(item.Link, "&") {
+						item.Link = strings.Split(item.Link, "?")[0]
 					}
-					itemTime := item.PublishedParsed
-					// We only want to show a feed item if itemTime > lastTime.
-					// Additionally we also want to make sure the feed item is no older than 4 hours.
-					// This assures only current news when restarting the bot or changing the feeds.
-					if itemTime.After(lastTime) && time.Since((*itemTime)) < 8*time.Duration(hns) {
-						if strings.Contains(item.Link, "?") && strings.Contains(item.Link, "&") {
-							item.Link = strings.Split(item.Link, "?")[0]
+					dg.ChannelMessageSend(feeds[feedData.Key].Channel, item.Link)
+					feeds[feedData.Key].Last = *itemTime
+					// The feeds file may have been edited since we loaded it, so we only update the last time
+					// of this feed on the current contents of the file instead of writing our copy back.
+					feed := feeds[feedData.Key]
+					err := st.UpdateFeeds(func(current []Feed) ([]Feed, error) {
+						for i, f := range current {
+							if f.URL == feed.URL && f.Channel == feed.Channel {
+								current[i].Last = feed.Last
+							}
 						}
-						dg.ChannelMessageSend(feeds[feedData.Key][2], item.Link)
-						feeds[feedData.Key][3] = itemTime.String()
-						writeCSV(feedsFile, feeds)
-						time.Sleep(1 * time.Second)
+						return current, nil
+					})
+					if err != nil {
+						log.Println("tskFeeds:", err)
 					}
+					time.Sleep(1 * time.Second)
 				}
-			case <-time.After(60 * time.Second):
-				timeout = true
-			}
-			if timeout {
-				break
 			}
+		case <-time.After(60 * time.Second):
+			return
 		}
 	}
 }
 
-// The tskEvents function runs in the background as a goroutine polling for new events.
+// The tskEvents function runs in the background as a goroutine announcing the events whose reminders are due.
 func tskEvents(dg *discordgo.Session) {
-	var announced [5]string                    // Small buffer to hold recently announced events.
-	var index = 0                              // Index used to reference the buffer above.
-	var timeFormat = "2006-01-02 15:04:05 UTC" // Time format string used by the time package.
-	// Loop that runs every minute opening the events CSV file and querying any event that starts within 5 minutes.
+	started := make(map[string]bool) // Guilds whose reminders were already worked out once since the bot started.
+	// Loop that sleeps until the next reminder of any guild is due, or until the events change, as that may change
+	// which reminder is next.
 	for {
-		time.Sleep(60 * time.Second)
-		mention := ""
-		image := ""
-		do := NewDiscordOutput(dg, 0xb40000, ":alarm_clock: STARTING IN 5 MINUTES", "")
-		do.Embeds = true
-		event, err := findNext("any", "any")
-		if err != nil {
-			log.Println("tskEvents:", err)
-			continue
-		}
-		t, err := time.Parse(timeFormat, event[3])
-		if err != nil {
-			log.Println("tskEvents: Error parsing time.")
-			continue
-		}
-		delta := time.Until(t)
-		if delta.Minutes() > 5 {
-			continue
-		}
-		// If the index becomes greather than what the buffer can hold, we reset it.
-		// Otherwise we check if the announced buffer already contains the next event.
-		// If it doesn't, the event is announced on the channel and added to the buffer.
-		if index > 4 {
-			index = 0
-		} else {
-			if !contains(announced[0:5], event[0]+" "+event[1]+" "+event[2]) {
-				fields := []map[string]string{}
-				category := map[string]string{
-					"Name":  "Category:",
-					"Value": event[0],
-				}
-				description := map[string]string{
-					"Name":  "Event:",
-					"Value": fmt.Sprintf("%s %s", event[1], event[2]),
-				}
-				fields = append(fields, category, description)
-				if event[5] != "" {
-					image = event[5]
-				}
-				if event[6] != "" {
-					roles := map[string]string{
-						"Name":  "Roles:",
-						"Value": event[6],
-					}
-					fields = append(fields, roles)
-					mention = event[6] + " "
-				}
-				dg.ChannelMessageSend(event[4], fmt.Sprintf("%sSTARTING IN 5 MINUTES: %s %s %s", mention, event[0], event[1], event[2]))
-				do.Fields = &fields
-				do.Image = &image
-				do.Send(event[4])
-				announced[index] = event[0] + " " + event[1] + " " + event[2]
-				index++
+		now := time.Now()
+		wake := now.Add(reminderMax)
+		for _, partition := range cfg().partitions() {
+			next, err := remindEvents(dg, partition, now, !started[partition])
+			if err != nil {
+				log.Println("tskEvents:", err)
+				next = now.Add(time.Minute)
+			} else {
+				started[partition] = true
+			}
+			if !next.IsZero() && next.Before(wake) {
+				wake = next
 			}
 		}
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-timer.C:
+		case <-eventsWake:
+			timer.Stop()
+		}
+	}
+}
+
+// Users whose messages tskStats must stop counting, as their data was deleted (see forgetStats).
+var forgetCh = make(chan string, 16)
+
+// The forgetStats function drops the messages of a user counted by tskStats but not saved to the stats file yet.
+// It doesn't wait for tskStats, which may not be running, so the user is skipped if too many are already waiting.
+func forgetStats(user string) {
+	select {
+	case forgetCh <- user:
+	default:
 	}
 }
 
 // The tskStats function runs in the background as a goroutine gathering statistics.
 func tskStats(dg *discordgo.Session) {
-	userCh := make(chan string)
+	// Simple structure type used to send the author of a message and the partition of its guild to a go channel.
+	type Message struct {
+		Guild string
+		User  string
+	}
+	messageCh := make(chan Message)
 	saveCh := make(chan string)
 	dg.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
 		if m.Author.ID == s.State.User.ID {
 			return
 		}
-		userCh <- m.Author.ID
+		messageCh <- Message{cfg().partition(m.GuildID), m.Author.ID}
 	})
-	stats, err := readCSV(statsFile)
-	if err != nil {
-		log.Println("tskStats:", err)
-		return
-	}
+	// Only the messages counted since the last save are kept in memory and then added to the stats file.
+	// This way the file can be changed by someone else in between saves without those changes being lost.
+	// The counts are kept per guild, as each guild has its own stats.
+	pending := make(map[string]map[string]int)
 	timer := time.AfterFunc(300*time.Second, func() {
 		saveCh <- "SAVE"
 	})
 	// Loop that runs a select on the two channels, one to gather stats, the other to save those stats to a file.
 	for {
 		select {
-		case user := <-userCh:
-			found := false
-			for i, v := range stats {
-				if strings.EqualFold(user, v[0]) {
-					old, err := strconv.Atoi(stats[i][1])
-					if err != nil {
-						log.Println("tskStats:", err)
-						return
+		case message := <-messageCh:
+			if pending[message.Guild] == nil {
+				pending[message.Guild] = make(map[string]int)
+			}
+			pending[message.Guild][message.User]++
+		case user := <-forgetCh:
+			for _, counts := range pending {
+				for u := range counts {
+					if strings.EqualFold(u, user) {
+						delete(counts, u)
 					}
-					stats[i][1] = fmt.Sprintf("%d", old+1)
-					found = true
 				}
 			}
-			if !found {
-				stats = append(stats, []string{user, "1"})
-			}
 		case <-saveCh:
 			timer.Reset(300 * time.Second)
-			err := writeCSV(statsFile, stats)
-			if err != nil {
-				log.Println("tskStats:", err)
+			for guild, counts := range pending {
+				err := store.Guild(guild).UpdateStats(func(stats []Stat) ([]Stat, error) {
+					added := make(map[string]bool)
+					for i, v := range stats {
+						for user, count := range counts {
+							if strings.EqualFold(user, v.User) {
+								stats[i].Messages += count
+								added[user] = true
+							}
+						}
+					}
+					for user, count := range counts {
+						if !added[user] {
+							stats = append(stats, Stat{User: user, Messages: count})
+						}
+					}
+					return stats, nil
+				})
+				if err != nil {
+					log.Println("tskStats:", err)
+					continue
+				}
+				delete(pending, guild)
 			}
 		}
 	}
@@ -222,7 +238,7 @@ func tskStats(dg *discordgo.Session) {
 func tskWrite(dg *discordgo.Session) {
 	for {
 		time.Sleep(1 * time.Second)
-		message, err := readIn(inputFile)
+		message, err := readIn(cfg().Files.Input)
 		if err != nil {
 			log.Println("tskWrite:", err)
 		}
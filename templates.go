@@ -0,0 +1,255 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"embed"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Templates of every message of the bot in English (templates.tmpl) and in other languages (templates.xx.tmpl),
+// used when the templates files don't define them (see Templates).
+//
+//go:embed templates*.tmpl
+var catalog embed.FS
+
+// Language of templates.tmpl, which every other language falls back to.
+const defaultLanguage = "en"
+
+// Functions available to the templates, on top of the ones text/template always has.
+// The weekday and month functions are replaced on each set of templates by ones using its language (see names).
+var templateFuncs = template.FuncMap{
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"weekday": func(t time.Time) string { return t.Weekday().String() },
+	"month":   func(t time.Time) string { return t.Month().String() },
+}
+
+var (
+	defaults       = parseCatalog(defaultLanguage) // Default templates, used when the others fail.
+	templatesMu    sync.Mutex                      // Protects templatesCache.
+	templatesCache = make(map[string]*Templates)   // Templates of each partition and language, by their files.
+)
+
+// Type that represents the values a template is executed with, which templates get with {{.Name}}.
+type vars map[string]interface{}
+
+// Type that represents the templates used to write the output of the bot on a guild, in some language.
+// Every message, title and the theme of the embeds (see Theme) is a named template, as on templates.tmpl.
+// The templates file of the files section can redefine any of them for every guild, and the templates file on the
+// data folder of a guild can redefine them again for that guild only. Templates that aren't redefined keep their
+// default, so the files only need the templates that are changed.
+// Other languages start from English and redefine its templates on their own files, named after the language code
+// (templates.pt.tmpl for Portuguese), both the ones of the bot and the ones next to the templates files.
+// Redefinitions on the templates files apply to every language, unless a language redefines them again.
+type Templates struct {
+	set   *template.Template
+	paths []string
+}
+
+// Type that represents the look of the embeds sent on a guild, taken from its templates.
+type Theme struct {
+	Color      int    // Color of the embeds of successful commands.
+	ErrorColor int    // Color of the embeds of commands that failed or were used wrongly.
+	Footer     string // Text of the footer of every embed.
+	FooterIcon string // URL of the icon of the footer of every embed.
+}
+
+// Templates are used on every output, so they are kept in memory until their files change on disk.
+func init() {
+	onDataChange(func(path string) {
+		templatesMu.Lock()
+		defer templatesMu.Unlock()
+		for key, t := range templatesCache {
+			if contains(t.paths, path) {
+				delete(templatesCache, key)
+			}
+		}
+	})
+}
+
+// The languages function returns the codes of the languages there are templates for, sorted.
+// Those are the languages of the bot and any other one with a file next to the templates file of the configuration.
+func languages(c *Config) []string {
+	found := map[string]bool{defaultLanguage: true}
+	entries, _ := catalog.ReadDir(".")
+	for _, entry := range entries {
+		if parts := strings.Split(entry.Name(), "."); len(parts) == 3 {
+			found[parts[1]] = true
+		}
+	}
+	matches, _ := filepath.Glob(localizedPath(c.Files.Templates, "*"))
+	for _, match := range matches {
+		if parts := strings.Split(filepath.Base(match), "."); len(parts) == 3 {
+			found[parts[1]] = true
+		}
+	}
+	return sortedKeys(found)
+}
+
+// Small utility function that returns the path of the templates of a language, next to a templates file.
+// The language code goes before the extension, so templates.tmpl becomes templates.pt.tmpl for Portuguese.
+func localizedPath(path string, language string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + language + ext
+}
+
+// The language function returns the language the messages to a user on a guild are written in.
+// That is the language the user picked, if any, or else the language of the guild.
+func language(guild string, user string) string {
+	if user != "" {
+		u, err := store.User(user)
+		if err == nil && u.Language != "" {
+			return u.Language
+		}
+	}
+	return cfg().guild(guild).Language
+}
+
+// The guildTemplates function returns the templates of a guild in its language, for messages meant for everyone.
+func guildTemplates(guild string) *Templates {
+	return localTemplates(guild, language(guild, ""))
+}
+
+// The userTemplates function returns the templates of a guild in the language of a user, for replies to the user.
+func userTemplates(guild string, user string) *Templates {
+	return localTemplates(guild, language(guild, user))
+}
+
+// The localTemplates function returns the templates of a guild in a language, from memory if possible.
+// Templates files that can't be read or parsed are logged and ignored, so that the bot keeps talking.
+func localTemplates(guild string, lang string) *Templates {
+	config := cfg()
+	files := []string{config.Files.Templates}
+	if path := config.files(config.partition(guild)).Templates; path != files[0] {
+		files = append(files, path)
+	}
+	var paths []string
+	for _, path := range files {
+		paths = append(paths, path)
+		if lang != defaultLanguage {
+			paths = append(paths, localizedPath(path, lang))
+		}
+	}
+	key := lang + "\n" + strings.Join(paths, "\n")
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	if t, ok := templatesCache[key]; ok {
+		return t
+	}
+	set := parseCatalog(lang)
+	for _, path := range paths {
+		if !fileExists(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Println("localTemplates:", err)
+			continue
+		}
+		// Each file is parsed on a copy, so that a broken file doesn't leave half of its templates behind.
+		parsed := template.Must(set.Clone())
+		_, err = parsed.New(path).Parse(string(data))
+		if err != nil {
+			log.Println("localTemplates:", err)
+			continue
+		}
+		set = parsed
+	}
+	t := &Templates{set: set, paths: paths}
+	set.Funcs(template.FuncMap{
+		"weekday": func(d time.Time) string { return t.names("weekdays", int(d.Weekday())) },
+		"month":   func(d time.Time) string { return t.names("months", int(d.Month())-1) },
+	})
+	templatesCache[key] = t
+	return t
+}
+
+// Small utility function that parses the templates of the bot in a language, on top of the English ones.
+// Templates can't be cloned once executed, so every set of templates starts from its own copy of them.
+func parseCatalog(lang string) *template.Template {
+	set := template.New("").Funcs(templateFuncs)
+	for _, name := range []string{"templates.tmpl", "templates." + lang + ".tmpl"} {
+		data, err := catalog.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		template.Must(set.New(name).Parse(string(data)))
+	}
+	return set
+}
+
+// The Text method executes the template with the given name and returns the resulting text.
+// If the template fails, the default one is used instead, and if there's no such template its name is returned.
+func (t *Templates) Text(name string, data vars) string {
+	var b strings.Builder
+	err := t.set.ExecuteTemplate(&b, name, data)
+	if err == nil {
+		return b.String()
+	}
+	log.Println("Text:", err)
+	b.Reset()
+	if defaults.ExecuteTemplate(&b, name, data) != nil {
+		return name
+	}
+	return b.String()
+}
+
+// The Has method returns whether there's a template with the given name.
+func (t *Templates) Has(name string) bool {
+	return t.set.Lookup(name) != nil
+}
+
+// The names method returns a name from a template listing names separated by spaces, like the weekdays and months
+// templates, which list the days of the week (starting on Sunday) and the months in the language of the templates.
+func (t *Templates) names(name string, index int) string {
+	names := strings.Fields(t.Text(name, nil))
+	if index < 0 || index >= len(names) {
+		return ""
+	}
+	return names[index]
+}
+
+// The Theme method returns the theme of the embeds, from the color, error_color, footer and footer_icon templates.
+// Colors are written in hexadecimal, like 0x3f82ef or #3f82ef.
+func (t *Templates) Theme() Theme {
+	color := func(name string, fallback int) int {
+		text := strings.TrimPrefix(strings.TrimSpace(t.Text(name, nil)), "#")
+		n, err := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(text), "0x"), 16, 32)
+		if err != nil {
+			log.Println("Theme:", err)
+			return fallback
+		}
+		return int(n)
+	}
+	return Theme{
+		Color:      color("color", colorInfo),
+		ErrorColor: color("error_color", colorError),
+		Footer:     strings.TrimSpace(t.Text("footer", nil)),
+		FooterIcon: strings.TrimSpace(t.Text("footer_icon", nil)),
+	}
+}
@@ -20,7 +20,8 @@ package main
 
 import (
 	"fmt"
-	"io"
+	"log"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -31,9 +32,14 @@ type Command struct {
 	Args    []string
 	User    string
 	Channel string
+	Guild   string
+	Options map[string]interface{} // Typed values of the options declared by the command (see CommandSpec.bind).
 }
 
 // Type that represents a Discord output sent by the bot.
+// Outputs that don't fit on a single message are split into pages (see Pages), which are either sent as several
+// messages or, if Paginate is set, as a single message with buttons to go through them.
+// Components (buttons and select menus) are shown below the output and handled by the component router (main.go).
 type DiscordOutput struct {
 	Session     *discordgo.Session
 	Color       int
@@ -42,95 +48,151 @@ type DiscordOutput struct {
 	Embeds      bool
 	Fields      *[]map[string]string
 	Image       *string
+	OnSend      func(m *discordgo.Message) // Called with the (first) message once the output is sent, if set.
+	Paginate    bool                       // Whether long outputs are shown one page at a time.
+	Components  []discordgo.MessageComponent
+	Files       []*discordgo.File // Files attached to the (first) message, which embeds can show as attachment://name.
 }
 
+// Type that represents a single message of an output, holding either text or an embed and its components.
+type Page struct {
+	Content    string
+	Embed      *discordgo.MessageEmbed
+	Components []discordgo.MessageComponent
+}
+
+// Colors of the outputs, which embeds show with the matching color of the theme of the guild (see Theme).
+const (
+	colorError = 0xb40000 // Outputs of commands that failed or were used wrongly.
+	colorInfo  = 0x3f82ef // Outputs of commands that succeeded.
+)
+
+// Limits Discord imposes on the size of messages and embeds, in characters.
+const (
+	messageLimit       = 2000
+	embedTitleLimit    = 256
+	embedTextLimit     = 4096
+	embedFieldsLimit   = 25
+	embedFieldLimit    = 1024
+	embedFieldKeyLimit = 256
+	embedTotalLimit    = 6000
+)
+
 func NewDiscordOutput(s *discordgo.Session, color int, title string, description string) *DiscordOutput {
-	return &DiscordOutput{s, color, title, description, false, nil, nil}
+	return &DiscordOutput{s, color, title, description, false, nil, nil, nil, false, nil, nil}
 }
 
-func (do *DiscordOutput) Send(channel string) {
-	if do.Embeds {
-		output := &discordgo.MessageEmbed{}
-		output.Title = do.Title
-		if do.Fields == nil {
-			output.Description = do.Description
-		}
-		output.Color = do.Color
-		if do.Fields != nil {
-			for _, v := range *do.Fields {
-				field := &discordgo.MessageEmbedField{}
-				field.Name = v["Name"]
-				field.Value = v["Value"]
-				output.Fields = append(output.Fields, field)
-			}
-		}
-		if do.Image != nil {
-			embedImage := &discordgo.MessageEmbedImage{}
-			embedImage.URL = *do.Image
-			output.Image = embedImage
-		}
-		footer := &discordgo.MessageEmbedFooter{}
-		footer.IconURL = "https://upload.wikimedia.org/wikipedia/commons/thumb/2/2d/Go_gopher_favicon.svg/2048px-Go_gopher_favicon.svg.png"
-		footer.Text = "Powered by Golang!"
-		output.Footer = footer
-		do.Session.ChannelMessageSendEmbed(channel, output)
-	} else {
-		if do.Fields != nil {
-			for _, v := range *do.Fields {
-				do.Description += fmt.Sprintf("**%s**\n%s\n", v["Name"], v["Value"])
+// The Send method sends the output to a channel of a guild, as one message per page or as a paginated message.
+func (do *DiscordOutput) Send(guild string, channel string) {
+	r := &Reply{Session: do.Session, Guild: guild, Channel: channel}
+	_, err := r.Send(do)
+	if err != nil {
+		log.Println("Send:", err)
+	}
+}
+
+// The Pages method splits the output into pages that fit the limits of Discord, with embeds of the given theme.
+// Text is split at line boundaries into messages of up to 2000 characters. Embeds get up to 4096 characters of
+// description each or, when there are fields, as many fields as fit on an embed, with long fields split in several,
+// below the description, which is repeated on every page as it is the header of the fields.
+// The components go on the last page, or on every page of paginated outputs, since only one page is shown at a time.
+func (do *DiscordOutput) Pages(theme Theme) (pages []Page) {
+	defer func() {
+		for i := range pages {
+			if do.Paginate || i == len(pages)-1 {
+				pages[i].Components = do.Components
 			}
 		}
-		if do.Image != nil {
-			do.Description += *do.Image
+	}()
+	if !do.Embeds {
+		for _, chunk := range splitText(do.Text(), messageLimit) {
+			pages = append(pages, Page{Content: chunk})
 		}
-		do.Session.ChannelMessageSend(channel, fmt.Sprintf("\n%s", do.Description))
+		return
 	}
-}
-
-func (do *DiscordOutput) Embed() (embed *discordgo.MessageEmbed) {
-	embed = &discordgo.MessageEmbed{}
-	embed.Title = do.Title
+	title := truncate(do.Title, embedTitleLimit)
+	embed := do.newEmbed(title, theme)
 	if do.Fields == nil {
-		embed.Description = do.Description
-	}
-	embed.Color = do.Color
-	if do.Fields != nil {
+		for i, chunk := range splitText(do.Description, embedTextLimit) {
+			if i > 0 {
+				pages = append(pages, Page{Embed: embed})
+				embed = do.newEmbed(title, theme)
+			}
+			embed.Description = chunk
+		}
+	} else {
+		header := truncate(strings.TrimSpace(do.Description), embedTextLimit)
+		embed.Description = header
+		size := len(title) + len(header)
 		for _, v := range *do.Fields {
-			field := &discordgo.MessageEmbedField{}
-			field.Name = v["Name"]
-			field.Value = v["Value"]
-			embed.Fields = append(embed.Fields, field)
+			name := truncate(v["Name"], embedFieldKeyLimit)
+			for i, value := range splitText(v["Value"], embedFieldLimit) {
+				// Continuations of a long field have an invisible name, so that they look like a single field.
+				if i > 0 {
+					name = "\u200b"
+				}
+				if len(embed.Fields) == embedFieldsLimit || size+len(name)+len(value) > embedTotalLimit-100 {
+					pages = append(pages, Page{Embed: embed})
+					embed = do.newEmbed(title, theme)
+					embed.Description = header
+					size = len(title) + len(header)
+				}
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: value})
+				size += len(name) + len(value)
+			}
 		}
 	}
+	pages = append(pages, Page{Embed: embed})
 	if do.Image != nil {
-		embedImage := &discordgo.MessageEmbedImage{}
-		embedImage.URL = *do.Image
-		embed.Image = embedImage
+		pages[0].Embed.Image = &discordgo.MessageEmbedImage{URL: *do.Image}
 	}
-	footer := &discordgo.MessageEmbedFooter{}
-	footer.IconURL = "https://upload.wikimedia.org/wikipedia/commons/thumb/2/2d/Go_gopher_favicon.svg/2048px-Go_gopher_favicon.svg.png"
-	footer.Text = "Powered by Golang!"
-	embed.Footer = footer
 	return
 }
 
-func (do *DiscordOutput) File(channel string, name string, r io.Reader, message string) {
-	do.Session.ChannelFileSendWithMessage(channel, message, name, r)
+// The newEmbed method returns an empty embed with the title and color of the output and the footer of the theme.
+func (do *DiscordOutput) newEmbed(title string, theme Theme) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{}
+	embed.Title = title
+	switch do.Color {
+	case colorError:
+		embed.Color = theme.ErrorColor
+	case colorInfo:
+		embed.Color = theme.Color
+	default:
+		embed.Color = do.Color
+	}
+	if theme.Footer != "" {
+		footer := &discordgo.MessageEmbedFooter{}
+		footer.IconURL = theme.FooterIcon
+		footer.Text = theme.Footer
+		embed.Footer = footer
+	}
+	return embed
 }
 
 func (do *DiscordOutput) Text() (text string) {
+	text = do.Description
 	if do.Fields != nil {
 		for _, v := range *do.Fields {
-			do.Description += fmt.Sprintf("**%s**\n%s\n", v["Name"], v["Value"])
+			text += fmt.Sprintf("**%s**\n%s\n", v["Name"], v["Value"])
 		}
 	}
 	if do.Image != nil {
-		do.Description += *do.Image
+		text += *do.Image
 	}
-	text = fmt.Sprintf("\n%s", do.Description)
+	text = fmt.Sprintf("\n%s", text)
 	return
 }
 
+// The message method returns the message of a page to send to a channel, with the given buttons before its own.
+func (p Page) message(components []discordgo.MessageComponent) *discordgo.MessageSend {
+	m := &discordgo.MessageSend{Content: p.Content, Components: append(components, p.Components...)}
+	if p.Embed != nil {
+		m.Embeds = []*discordgo.MessageEmbed{p.Embed}
+	}
+	return m
+}
+
 // Type that represents a score that can be sorted by points.
 type Score struct {
 	Key    string
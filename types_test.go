@@ -0,0 +1,82 @@
+/*
+ *  glucord, a simple general purpose bot for Discord.
+ *  Copyright (C) 2022  Vasco Costa (gluon)
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPagesFieldsWithDescription(t *testing.T) {
+	fields := []map[string]string{}
+	for i := 0; i < 30; i++ {
+		fields = append(fields, map[string]string{"Name": fmt.Sprintf("Day %d", i), "Value": "Race at 15:00\n"})
+	}
+	do := NewDiscordOutput(nil, colorInfo, "EVENTS", "Events on your time zone, Europe/Lisbon:\n")
+	do.Fields = &fields
+	do.Paginate = true
+	// On embeds, every page has the description above its fields.
+	do.Embeds = true
+	pages := do.Pages(Theme{})
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+	count := 0
+	for i, page := range pages {
+		if page.Embed == nil {
+			t.Fatalf("page %d has no embed", i)
+		}
+		if page.Embed.Description != "Events on your time zone, Europe/Lisbon:" {
+			t.Errorf("page %d description = %q", i, page.Embed.Description)
+		}
+		if len(page.Embed.Fields) > embedFieldsLimit {
+			t.Errorf("page %d has %d fields", i, len(page.Embed.Fields))
+		}
+		count += len(page.Embed.Fields)
+	}
+	if count != len(fields) {
+		t.Errorf("pages have %d fields, want %d", count, len(fields))
+	}
+	// On text, the description comes before the fields.
+	do.Embeds = false
+	pages = do.Pages(Theme{})
+	if len(pages) == 0 || !strings.HasPrefix(strings.TrimSpace(pages[0].Content), "Events on your time zone, Europe/Lisbon:\n**Day 0**") {
+		t.Errorf("text pages = %+v", pages)
+	}
+}
+
+func TestPagesDescription(t *testing.T) {
+	do := NewDiscordOutput(nil, colorInfo, "TITLE", strings.Repeat("line of text\n", 500))
+	do.Embeds = true
+	pages := do.Pages(Theme{})
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+	text := ""
+	for _, page := range pages {
+		if len(page.Embed.Description) > embedTextLimit || page.Embed.Fields != nil {
+			t.Errorf("page = %+v", page.Embed)
+		}
+		text += page.Embed.Description
+	}
+	if strings.Count(text, "line of text") != 500 {
+		t.Errorf("pages lost part of the description")
+	}
+}
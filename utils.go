@@ -21,10 +21,16 @@ package main
 import (
 	"encoding/csv"
 	"errors"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"unicode"
 )
 
+// Error returned by parseCommand when a message is not a command.
+var errNotCommand = errors.New("invalid command")
+
 // Small utility function that returns weather a slice of strings contains a given string.
 func contains(s []string, str string) bool {
 	for _, v := range s {
@@ -35,14 +41,23 @@ func contains(s []string, str string) bool {
 	return false
 }
 
-// Small utility function that returns whether a user exists or not.
-func isUser(user string, users [][]string) bool {
-	for _, v := range users {
-		if strings.EqualFold(user, v[0]) {
-			return true
-		}
+// Small utility function that returns whether a user prefers embeds or not.
+// Users that aren't registered on the bot get plain text output by default.
+func embedsEnabled(user string) (bool, error) {
+	u, err := store.User(user)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
 	}
-	return false
+	return u.Embeds, err
+}
+
+// Small utility function that returns the keys of a map with string keys in alphabetical order.
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
 }
 
 // Small utility function that reads a CSV file and returns the data as slice of slice of strings.
@@ -54,6 +69,7 @@ func readCSV(path string) (data [][]string, err error) {
 	}
 	defer f.Close()
 	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
 	data, err = r.ReadAll()
 	if err != nil {
 		err = errors.New("Error reading data from: " + path + ".")
@@ -75,15 +91,19 @@ func readIn(path string) (message string, err error) {
 }
 
 // Small utility function that writes a slice of slice of strings to a CSV file.
+// The file is locked while being written and replaced atomically (see writeFileAtomic).
 func writeCSV(path string, data [][]string) (err error) {
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		err = errors.New("Error opening CSV file: " + path + ".")
-		return
-	}
-	defer f.Close()
-	w := csv.NewWriter(f)
-	err = w.WriteAll(data)
+	unlock := lockFile(path)
+	defer unlock()
+	return writeCSVLocked(path, data)
+}
+
+// Small utility function that writes a slice of slice of strings to a CSV file whose lock is already held.
+func writeCSVLocked(path string, data [][]string) (err error) {
+	err = writeFileAtomic(path, func(f io.Writer) error {
+		w := csv.NewWriter(f)
+		return w.WriteAll(data)
+	})
 	if err != nil {
 		err = errors.New("Error writing data to: " + path + ".")
 		return
@@ -92,18 +112,33 @@ func writeCSV(path string, data [][]string) (err error) {
 }
 
 // Small utility function that takes a message string and breaks it down into a Command.
-func parseCommand(message string, user string, channel string) (command Command, err error) {
-	if len(message) > 1 && strings.HasPrefix(message, prefix) {
-		split := strings.Split(message, " ")
-		command.Name = split[0][1:]
-		command.Args = split[1:]
-		command.User = user
-		command.Channel = channel
+// The prefix of the commands is the one configured for the guild where the message was sent.
+// Messages that aren't commands return errNotCommand, while other errors mean the arguments couldn't be parsed.
+func parseCommand(message string, user string, channel string, guild string) (command Command, err error) {
+	prefix := cfg().guild(guild).Prefix
+	// A space right after the prefix means this is just a message starting with the prefix.
+	if len(message) <= len(prefix) || !strings.HasPrefix(message, prefix) || unicode.IsSpace(rune(message[len(prefix)])) {
+		err = errNotCommand
 		return
-	} else {
-		err = errors.New("invalid command")
+	}
+	args, err := splitArgs(message[len(prefix):])
+	if err != nil {
+		// Only commands are told about their arguments, other messages starting with the prefix are ignored.
+		if _, ok := commandName(strings.Fields(message[len(prefix):])[0]); !ok {
+			err = errNotCommand
+		}
+		return
+	}
+	if len(args) == 0 {
+		err = errNotCommand
 		return
 	}
+	command.Name = args[0]
+	command.Args = args[1:]
+	command.User = user
+	command.Channel = channel
+	command.Guild = guild
+	return
 }
 
 // Small utility function that checks if a file exists and is not a directory.
@@ -116,34 +151,9 @@ func fileExists(filename string) bool {
 }
 
 func lookupAlias(search string) (result string, err error) {
-	alias, err := readCSV(aliasFile)
+	result, err = store.Alias(search)
 	if err != nil {
 		err = errors.New("alias not found")
-		return
-	}
-	for _, v := range alias {
-		if strings.EqualFold(search, v[0]) {
-			result = v[1]
-			return
-		}
-	}
-	err = errors.New("alias not found")
-	return
-}
-
-// Small utility function that returns a map[string]string given a [][]string and a key/value pair.
-func toStringMap(s [][]string, key int, value int) (result map[string]string, err error) {
-	if len(s) == 0 || key < 0 || value < 0 || key >= value {
-		err := errors.New("invalid slice key or value")
-		return result, err
-	}
-	result = make(map[string]string)
-	for _, v := range s {
-		if (key > (len(v) - 1)) || (value > (len(v) - 1)) {
-			err := errors.New("invalid slice key or value")
-			return result, err
-		}
-		result[v[key]] = v[value]
 	}
 	return
 }